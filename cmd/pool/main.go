@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+)
+
+func readStreams(path string) ([]stream.Stream, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	var streams []stream.Stream
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		streams = append(streams, stream.Stream(line))
+	}
+
+	return streams, scanner.Err()
+}
+
+func main() {
+	multicastPool, err := multicastpool.Parse("239.0.0.0/16")
+	if err != nil {
+		panic(err)
+	}
+
+	overrides := flag.String("overrides", "", "JSON file with stream to group overrides")
+	streamsFile := flag.String("streams", "", "file with one stream name per line")
+	group := flag.String("group", "", "only list the streams mapped to this group")
+	jsonOutput := flag.Bool("json", false, "print the analysis as JSON")
+
+	flag.Var(multicastPool, "pool", "multicast pool")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [stream...]\n\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Analyzes how streams are mapped onto a multicast pool.\n\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *overrides != "" {
+		if err := multicastPool.LoadOverridesFile(*overrides); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load overrides: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	streams := make([]stream.Stream, 0)
+
+	if *streamsFile != "" {
+		s, err := readStreams(*streamsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read streams: %v\n", err)
+			os.Exit(1)
+		}
+
+		streams = append(streams, s...)
+	}
+
+	for _, arg := range flag.Args() {
+		streams = append(streams, stream.Stream(arg))
+	}
+
+	if *group != "" {
+		ip := net.ParseIP(*group)
+		if ip == nil {
+			fmt.Fprintf(os.Stderr, "Invalid group %q\n", *group)
+			os.Exit(1)
+		}
+
+		for _, s := range multicastPool.StreamsForGroup(ip, streams) {
+			fmt.Println(s)
+		}
+
+		return
+	}
+
+	type mapping struct {
+		Stream  stream.Stream `json:"stream"`
+		Address string        `json:"address"`
+	}
+
+	type analysis struct {
+		Pool        string                    `json:"pool"`
+		Fingerprint multicastpool.Fingerprint `json:"fingerprint"`
+		Warning     string                    `json:"warning,omitempty"`
+		Streams     []mapping                 `json:"streams"`
+		Collisions  []multicastpool.Collision `json:"collisions"`
+	}
+
+	a := analysis{
+		Pool:        multicastPool.String(),
+		Fingerprint: multicastPool.Fingerprint(),
+		Streams:     make([]mapping, 0, len(streams)),
+		Collisions:  multicastPool.Collisions(streams),
+	}
+
+	if err := multicastPool.Validate(); err != nil {
+		a.Warning = err.Error()
+	}
+
+	for _, s := range streams {
+		a.Streams = append(a.Streams, mapping{
+			Stream:  s,
+			Address: multicastPool.AddressForStream(s).String(),
+		})
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+
+		if err := enc.Encode(a); err != nil {
+			panic(err)
+		}
+	} else {
+		fmt.Printf("Pool %s (fingerprint %s)\n", a.Pool, a.Fingerprint)
+
+		if a.Warning != "" {
+			fmt.Printf("Warning: %s\n", a.Warning)
+		}
+
+		for _, m := range a.Streams {
+			fmt.Printf("%s\t%s\n", m.Stream, m.Address)
+		}
+
+		for _, c := range a.Collisions {
+			fmt.Printf("Collision on %s: %s\n", c.Group, strings.Join(streamNames(c.Streams), ", "))
+		}
+	}
+
+	if len(a.Collisions) > 0 || a.Warning != "" {
+		os.Exit(2)
+	}
+}
+
+func streamNames(streams []stream.Stream) []string {
+	names := make([]string, 0, len(streams))
+
+	for _, s := range streams {
+		names = append(names, s.String())
+	}
+
+	return names
+}
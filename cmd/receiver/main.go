@@ -1,11 +1,13 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"net"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/holoplot/go-racket/pkg/ifselect"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
 	racket "github.com/holoplot/go-racket/pkg/racket/receiver"
@@ -15,8 +17,7 @@ import (
 )
 
 func main() {
-	_, base, _ := net.ParseCIDR("239.0.0.0/16")
-	multicastPool, err := multicastpool.New(*base)
+	multicastPool, err := multicastpool.Parse("239.0.0.0/16")
 	if err != nil {
 		panic(err)
 	}
@@ -26,19 +27,56 @@ func main() {
 		Parts: []string{"org", "foo", "*"},
 	}
 
-	lo, err := net.InterfaceByName("lo")
-	if err != nil {
-		panic(err)
+	overrides := flag.String("overrides", "", "JSON file with stream to group overrides")
+
+	var multicastPool6 multicastpool.Pool
+
+	interfaces := ifselect.All()
+
+	flag.Var(multicastPool, "pool", "multicast pool")
+	flag.Var(&multicastPool6, "pool6", "additional IPv6 multicast pool for dual-stack operation")
+	flag.Var(interfaces, "interfaces", "interfaces to use: names with globs, !excluded names, CIDRs or \"all\"")
+	flag.Var(&st, "stream", "stream to subscribe to")
+	flag.Var(&su, "subject", "subject to subscribe to")
+	flag.Parse()
+
+	// The default leaves out loopback, which is all a host without a
+	// network has, so the demo falls back to it there.
+	if _, err := interfaces.Select(); errors.Is(err, ifselect.ErrNoInterfaces) && interfaces.String() == "all" {
+		interfaces = &ifselect.Selector{Include: []string{"lo*"}}
+	}
+
+	pools := []*multicastpool.Pool{multicastPool}
+	opts := []racket.Opt{}
+
+	if multicastPool6.String() != "" {
+		pools = append(pools, &multicastPool6)
+		opts = append(opts, racket.Pools(&multicastPool6))
+	}
+
+	for _, pool := range pools {
+		if err := pool.Validate(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
 	}
 
-	eth, err := net.InterfaceByName("enp0s31f6")
+	if *overrides != "" {
+		for _, pool := range pools {
+			if err := pool.LoadOverridesFile(*overrides); err != nil {
+				panic(err)
+			}
+		}
+	}
+
+	receiver, err := racket.New(nil, multicastPool, append(opts, racket.SelectInterfaces(interfaces))...)
 	if err != nil {
 		panic(err)
 	}
 
-	ifis := []*net.Interface{lo, eth}
-
-	receiver := racket.New(ifis, multicastPool)
+	receiver.OnPoolMismatch(func(m racket.PoolMismatch) {
+		fmt.Printf("Node %x at %s uses pool %s (fingerprint %s), expected %s (fingerprint %s)\n",
+			m.Node, m.Addr, m.Pool, m.Fingerprint, multicastPool, multicastPool.Fingerprint())
+	})
 
 	if _, err := receiver.Subscribe(st, su, func(msg *message.Message) {
 		fmt.Printf("Received message on subject %s (%d bytes)\n", msg.Subject, len(msg.Data))
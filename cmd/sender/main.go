@@ -1,13 +1,15 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand/v2"
-	"net"
 	"time"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/holoplot/go-racket/pkg/ifselect"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
 	racket "github.com/holoplot/go-racket/pkg/racket/sender"
@@ -26,25 +28,51 @@ func randomBytes(size int) []byte {
 }
 
 func main() {
-	_, base, _ := net.ParseCIDR("239.0.0.0/16")
-	multicastPool, err := multicastpool.New(*base)
+	multicastPool, err := multicastpool.Parse("239.0.0.0/16")
 	if err != nil {
 		panic(err)
 	}
 
-	lo, err := net.InterfaceByName("lo")
-	if err != nil {
-		panic(err)
+	overrides := flag.String("overrides", "", "JSON file with stream to group overrides")
+
+	var multicastPool6 multicastpool.Pool
+
+	interfaces := ifselect.All()
+
+	flag.Var(multicastPool, "pool", "multicast pool")
+	flag.Var(&multicastPool6, "pool6", "additional IPv6 multicast pool for dual-stack operation")
+	flag.Var(interfaces, "interfaces", "interfaces to use: names with globs, !excluded names, CIDRs or \"all\"")
+	flag.Parse()
+
+	// The default leaves out loopback, which is all a host without a
+	// network has, so the demo falls back to it there.
+	if _, err := interfaces.Select(); errors.Is(err, ifselect.ErrNoInterfaces) && interfaces.String() == "all" {
+		interfaces = &ifselect.Selector{Include: []string{"lo*"}}
 	}
 
-	eth, err := net.InterfaceByName("enp0s31f6")
-	if err != nil {
-		panic(err)
+	pools := []*multicastpool.Pool{multicastPool}
+	opts := []racket.Opt{}
+
+	if multicastPool6.String() != "" {
+		pools = append(pools, &multicastPool6)
+		opts = append(opts, racket.Pools(&multicastPool6))
+	}
+
+	for _, pool := range pools {
+		if err := pool.Validate(); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
 	}
 
-	ifis := []*net.Interface{lo, eth}
+	if *overrides != "" {
+		for _, pool := range pools {
+			if err := pool.LoadOverridesFile(*overrides); err != nil {
+				panic(err)
+			}
+		}
+	}
 
-	sender, err := racket.New(ifis, multicastPool)
+	sender, err := racket.New(nil, multicastPool, append(opts, racket.SelectInterfaces(interfaces))...)
 	if err != nil {
 		panic(err)
 	}
@@ -83,5 +111,5 @@ func main() {
 		time.Sleep(time.Second)
 	}
 
-	sender.Flush()
+	sender.Close()
 }
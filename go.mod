@@ -6,12 +6,6 @@ toolchain go1.24.2
 
 require (
 	github.com/davecgh/go-spew v1.1.1
-	github.com/rs/zerolog v1.34.0
 	golang.org/x/net v0.39.0
-)
-
-require (
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.19 // indirect
-	golang.org/x/sys v0.32.0 // indirect
+	golang.org/x/sys v0.32.0
 )
@@ -0,0 +1,201 @@
+// Package ifselect picks network interfaces by name, address or capability.
+package ifselect
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNoInterfaces = errors.New("no matching interfaces")
+	ErrInvalidToken = errors.New("invalid selector token")
+)
+
+// Selector describes a set of interfaces. An interface is selected if it
+// matches all of the given criteria.
+type Selector struct {
+	// Include lists glob patterns of interface names. If empty, any name
+	// matches.
+	Include []string
+
+	// Exclude lists glob patterns of interface names that never match.
+	Exclude []string
+
+	// Networks restricts the selection to interfaces with an address in
+	// one of these networks.
+	Networks []*net.IPNet
+
+	// AllMulticast restricts the selection to interfaces that are up,
+	// multicast-capable and not loopback.
+	AllMulticast bool
+}
+
+// All selects all interfaces that are up, multicast-capable and not loopback.
+func All() *Selector {
+	return &Selector{
+		AllMulticast: true,
+	}
+}
+
+// Parse reads a comma-separated list of tokens. "all" sets AllMulticast,
+// CIDRs such as "10.0.0.0/8" are added to Networks, names prefixed with "!"
+// to Exclude and all other names to Include. Names may contain globs.
+func Parse(s string) (*Selector, error) {
+	sel := &Selector{}
+
+	if err := sel.Set(s); err != nil {
+		return nil, err
+	}
+
+	return sel, nil
+}
+
+// Matches reports whether ifi with the given addresses is selected.
+func (s *Selector) Matches(ifi *net.Interface, addrs []net.Addr) bool {
+	if s.AllMulticast {
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagMulticast == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			return false
+		}
+	}
+
+	if len(s.Include) > 0 && !matchAny(s.Include, ifi.Name) {
+		return false
+	}
+
+	if matchAny(s.Exclude, ifi.Name) {
+		return false
+	}
+
+	if len(s.Networks) == 0 {
+		return true
+	}
+
+	for _, addr := range addrs {
+		ipn, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		for _, n := range s.Networks {
+			if n.Contains(ipn.IP) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Select returns the selected interfaces of the host, or ErrNoInterfaces if
+// there are none.
+func (s *Selector) Select() ([]*net.Interface, error) {
+	all, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	var ifis []*net.Interface
+
+	for i := range all {
+		ifi := &all[i]
+
+		var addrs []net.Addr
+
+		if len(s.Networks) > 0 {
+			if addrs, err = ifi.Addrs(); err != nil {
+				return nil, fmt.Errorf("failed to list addresses of %s: %w", ifi.Name, err)
+			}
+		}
+
+		if s.Matches(ifi, addrs) {
+			ifis = append(ifis, ifi)
+		}
+	}
+
+	if len(ifis) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoInterfaces, s)
+	}
+
+	return ifis, nil
+}
+
+func (s *Selector) String() string {
+	if s == nil {
+		return ""
+	}
+
+	var tokens []string
+
+	if s.AllMulticast {
+		tokens = append(tokens, "all")
+	}
+
+	tokens = append(tokens, s.Include...)
+
+	for _, e := range s.Exclude {
+		tokens = append(tokens, "!"+e)
+	}
+
+	for _, n := range s.Networks {
+		tokens = append(tokens, n.String())
+	}
+
+	return strings.Join(tokens, ",")
+}
+
+// Set implements flag.Value.
+func (s *Selector) Set(v string) error {
+	*s = Selector{}
+
+	for _, token := range strings.Split(v, ",") {
+		token = strings.TrimSpace(token)
+
+		switch {
+		case token == "":
+		case token == "all":
+			s.AllMulticast = true
+		case strings.HasPrefix(token, "!"):
+			if err := validatePattern(token[1:]); err != nil {
+				return err
+			}
+
+			s.Exclude = append(s.Exclude, token[1:])
+		case strings.Contains(token, "/"):
+			_, n, err := net.ParseCIDR(token)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrInvalidToken, token)
+			}
+
+			s.Networks = append(s.Networks, n)
+		default:
+			if err := validatePattern(token); err != nil {
+				return err
+			}
+
+			s.Include = append(s.Include, token)
+		}
+	}
+
+	return nil
+}
+
+func validatePattern(p string) error {
+	if _, err := path.Match(p, ""); err != nil || p == "" {
+		return fmt.Errorf("%w: %q", ErrInvalidToken, p)
+	}
+
+	return nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
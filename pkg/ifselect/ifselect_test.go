@@ -0,0 +1,91 @@
+package ifselect
+
+import (
+	"errors"
+	"flag"
+	"net"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("all, eth*,!docker*,10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if !s.AllMulticast || len(s.Include) != 1 || len(s.Exclude) != 1 || len(s.Networks) != 1 {
+		t.Errorf("unexpected selector %+v", s)
+	}
+
+	if s.String() != "all,eth*,!docker*,10.0.0.0/8" {
+		t.Errorf("unexpected string %q", s.String())
+	}
+
+	for _, v := range []string{"10.0.0.0/33", "!", "eth[", "!eth["} {
+		if _, err := Parse(v); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("expected %q to be invalid, got %v", v, err)
+		}
+	}
+}
+
+func TestSelector_Matches(t *testing.T) {
+	eth0 := &net.Interface{Name: "eth0", Flags: net.FlagUp | net.FlagMulticast}
+	eth1 := &net.Interface{Name: "eth1", Flags: net.FlagMulticast}
+	docker0 := &net.Interface{Name: "docker0", Flags: net.FlagUp | net.FlagMulticast}
+	lo := &net.Interface{Name: "lo", Flags: net.FlagUp | net.FlagLoopback}
+
+	_, lan, _ := net.ParseCIDR("192.0.2.0/24")
+	addrs := []net.Addr{&net.IPNet{IP: net.IPv4(192, 0, 2, 7), Mask: net.CIDRMask(24, 32)}}
+
+	for _, tc := range []struct {
+		selector *Selector
+		ifi      *net.Interface
+		addrs    []net.Addr
+		expected bool
+	}{
+		{All(), eth0, nil, true},
+		{All(), eth1, nil, false},
+		{All(), lo, nil, false},
+		{&Selector{}, lo, nil, true},
+		{&Selector{Include: []string{"lo"}}, lo, nil, true},
+		{&Selector{Include: []string{"eth*"}}, docker0, nil, false},
+		{&Selector{AllMulticast: true, Exclude: []string{"docker*"}}, docker0, nil, false},
+		{&Selector{AllMulticast: true, Exclude: []string{"docker*"}}, eth0, nil, true},
+		{&Selector{Networks: []*net.IPNet{lan}}, eth0, addrs, true},
+		{&Selector{Networks: []*net.IPNet{lan}}, eth0, nil, false},
+	} {
+		if tc.selector.Matches(tc.ifi, tc.addrs) != tc.expected {
+			t.Errorf("expected %q to match %s: %v", tc.selector, tc.ifi.Name, tc.expected)
+		}
+	}
+}
+
+func TestSelector_Select(t *testing.T) {
+	ifis, err := (&Selector{Include: []string{"lo"}}).Select()
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	if len(ifis) != 1 || ifis[0].Name != "lo" {
+		t.Errorf("expected lo, got %v", ifis)
+	}
+
+	if _, err := (&Selector{Include: []string{"does-not-exist*"}}).Select(); !errors.Is(err, ErrNoInterfaces) {
+		t.Errorf("expected no interfaces, got %v", err)
+	}
+}
+
+func TestSelector_Flag(t *testing.T) {
+	s := All()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Var(s, "interfaces", "")
+
+	if err := fs.Parse([]string{"-interfaces", "lo,eth*"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if s.AllMulticast || len(s.Include) != 2 {
+		t.Errorf("unexpected selector %+v", s)
+	}
+}
@@ -0,0 +1,149 @@
+package multicast
+
+import (
+	"net"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	NetworkIPv4 = "udp4"
+	NetworkIPv6 = "udp6"
+)
+
+// Network returns the network a group address belongs to.
+func Network(ip net.IP) string {
+	if ip.To4() != nil {
+		return NetworkIPv4
+	}
+
+	return NetworkIPv6
+}
+
+var ssmRange = &net.IPNet{
+	IP:   net.IPv4(232, 0, 0, 0).To4(),
+	Mask: net.CIDRMask(8, 32),
+}
+
+// IsSourceSpecific reports whether a group is in the source-specific
+// multicast range, 232.0.0.0/8 or ff3x::/32.
+func IsSourceSpecific(ip net.IP) bool {
+	if ip.To4() != nil {
+		return ssmRange.Contains(ip)
+	}
+
+	ip = ip.To16()
+
+	return ip != nil && ip[0] == 0xff && ip[1]&0xf0 == 0x30 && ip[2] == 0 && ip[3] == 0
+}
+
+// PacketConn hides the differences between IPv4 and IPv6 multicast sockets.
+type PacketConn struct {
+	network string
+	v4      *ipv4.PacketConn
+	v6      *ipv6.PacketConn
+}
+
+func newPacketConn(network string, c net.PacketConn) *PacketConn {
+	pc := &PacketConn{
+		network: network,
+	}
+
+	if network == NetworkIPv6 {
+		pc.v6 = ipv6.NewPacketConn(c)
+	} else {
+		pc.v4 = ipv4.NewPacketConn(c)
+	}
+
+	return pc
+}
+
+func (c *PacketConn) Network() string {
+	return c.network
+}
+
+func (c *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.v6 != nil {
+		return c.v6.WriteTo(b, nil, addr)
+	}
+
+	return c.v4.WriteTo(b, nil, addr)
+}
+
+// ReadFrom reads a packet and returns, along with its size and source, the
+// group it was sent to and the index of the interface it arrived on. This
+// requires enableDestination to be called first.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.IP, int, net.Addr, error) {
+	if c.v6 != nil {
+		n, cm, src, err := c.v6.ReadFrom(b)
+		if err != nil || cm == nil {
+			return n, nil, 0, src, err
+		}
+
+		return n, cm.Dst, cm.IfIndex, src, nil
+	}
+
+	n, cm, src, err := c.v4.ReadFrom(b)
+	if err != nil || cm == nil {
+		return n, nil, 0, src, err
+	}
+
+	return n, cm.Dst, cm.IfIndex, src, nil
+}
+
+func (c *PacketConn) enableDestination() error {
+	if c.v6 != nil {
+		return c.v6.SetControlMessage(ipv6.FlagDst|ipv6.FlagInterface, true)
+	}
+
+	return c.v4.SetControlMessage(ipv4.FlagDst|ipv4.FlagInterface, true)
+}
+
+func (c *PacketConn) JoinGroup(ifi *net.Interface, group net.Addr) error {
+	if c.v6 != nil {
+		return c.v6.JoinGroup(ifi, group)
+	}
+
+	return c.v4.JoinGroup(ifi, group)
+}
+
+func (c *PacketConn) LeaveGroup(ifi *net.Interface, group net.Addr) error {
+	if c.v6 != nil {
+		return c.v6.LeaveGroup(ifi, group)
+	}
+
+	return c.v4.LeaveGroup(ifi, group)
+}
+
+func (c *PacketConn) JoinSourceSpecificGroup(ifi *net.Interface, group, source net.Addr) error {
+	if c.v6 != nil {
+		return c.v6.JoinSourceSpecificGroup(ifi, group, source)
+	}
+
+	return c.v4.JoinSourceSpecificGroup(ifi, group, source)
+}
+
+func (c *PacketConn) LeaveSourceSpecificGroup(ifi *net.Interface, group, source net.Addr) error {
+	if c.v6 != nil {
+		return c.v6.LeaveSourceSpecificGroup(ifi, group, source)
+	}
+
+	return c.v4.LeaveSourceSpecificGroup(ifi, group, source)
+}
+
+func (c *PacketConn) SetMulticastInterface(ifi *net.Interface) error {
+	if c.v6 != nil {
+		return c.v6.SetMulticastInterface(ifi)
+	}
+
+	return c.v4.SetMulticastInterface(ifi)
+}
+
+func (c *PacketConn) Close() error {
+	if c.v6 != nil {
+		return c.v6.Close()
+	}
+
+	return c.v4.Close()
+}
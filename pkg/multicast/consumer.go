@@ -6,10 +6,33 @@ type consumers []*Consumer
 
 type Consumer struct {
 	addr       *net.UDPAddr
-	cb         func([]byte)
+	sources    []net.IP
+	cb         func([]byte, net.Addr, string)
 	dispatcher *Dispatcher
 }
 
 func (c *Consumer) Close() {
 	c.dispatcher.removeConsumer(c)
 }
+
+// accepts reports whether a packet from src is meant for this consumer.
+// Source-specific consumers share a group membership with others that
+// may have joined further sources.
+func (c *Consumer) accepts(src net.Addr) bool {
+	if len(c.sources) == 0 {
+		return true
+	}
+
+	udpAddr, ok := src.(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, s := range c.sources {
+		if s.Equal(udpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
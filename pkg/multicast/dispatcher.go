@@ -1,42 +1,85 @@
 package multicast
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
+	"slices"
 	"sync"
 )
 
+var (
+	ErrNotSourceSpecific  = errors.New("group is not in the source-specific multicast range")
+	ErrInvalidSource      = errors.New("source does not match the group's network")
+	ErrMembershipConflict = errors.New("group is joined both for any source and for specific sources")
+)
+
+type listenerKey struct {
+	network string
+	port    int
+}
+
 type Dispatcher struct {
 	mutex     sync.Mutex
 	ifis      []*net.Interface
-	listeners map[int]*listener
+	options   SocketOptions
+	logger    *slog.Logger
+	listeners map[listenerKey]*listener
+
+	// Limits the number of callbacks running at the same time, if set
+	sem chan struct{}
 }
 
-func (d *Dispatcher) AddConsumer(addr *net.UDPAddr, cb func([]byte)) (*Consumer, error) {
+// AddConsumer joins the group addr and delivers its packets to cb. If
+// sources are given, the group is joined source-specifically (SSM) and
+// only packets of these sources are delivered.
+func (d *Dispatcher) AddConsumer(addr *net.UDPAddr, cb func([]byte, net.Addr, string), sources ...net.IP) (*Consumer, error) {
+	if len(sources) > 0 && !IsSourceSpecific(addr.IP) {
+		return nil, fmt.Errorf("%w: %s", ErrNotSourceSpecific, addr.IP)
+	}
+
+	for _, source := range sources {
+		if Network(source) != Network(addr.IP) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSource, source)
+		}
+	}
+
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
 	c := &Consumer{
 		addr:       addr,
+		sources:    sources,
 		cb:         cb,
 		dispatcher: d,
 	}
 
-	l, ok := d.listeners[addr.Port]
+	k := listenerKey{
+		network: Network(addr.IP),
+		port:    addr.Port,
+	}
+
+	l, ok := d.listeners[k]
 	if !ok {
 		var err error
 
-		l, err = newListener(addr.Port, d.ifis)
+		l, err = newListener(k.network, k.port, d)
 		if err != nil {
 			return nil, err
 		}
-
-		d.listeners[addr.Port] = l
 	}
 
 	if err := l.addConsumer(c); err != nil {
+		if !ok {
+			l.close()
+		}
+
 		return nil, err
 	}
 
+	d.listeners[k] = l
+
 	return c, nil
 }
 
@@ -44,7 +87,12 @@ func (d *Dispatcher) removeConsumer(c *Consumer) {
 	d.mutex.Lock()
 	defer d.mutex.Unlock()
 
-	l, ok := d.listeners[c.addr.Port]
+	k := listenerKey{
+		network: Network(c.addr.IP),
+		port:    c.addr.Port,
+	}
+
+	l, ok := d.listeners[k]
 	if !ok {
 		return
 	}
@@ -54,7 +102,7 @@ func (d *Dispatcher) removeConsumer(c *Consumer) {
 	if !l.hasConsumers() {
 		l.close()
 
-		delete(d.listeners, c.addr.Port)
+		delete(d.listeners, k)
 	}
 }
 
@@ -70,12 +118,90 @@ func (d *Dispatcher) Close() {
 }
 
 func (d *Dispatcher) Interfaces() []*net.Interface {
-	return d.ifis
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return slices.Clone(d.ifis)
 }
 
-func NewDispatcher(ifis []*net.Interface) *Dispatcher {
-	return &Dispatcher{
+// SetInterfaces changes the interfaces groups are joined on. Memberships
+// on interfaces that are no longer in ifis are left, and all groups are
+// joined on the new ones.
+func (d *Dispatcher) SetInterfaces(ifis []*net.Interface) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.ifis = slices.Clone(ifis)
+
+	var errs []error
+
+	for _, l := range d.listeners {
+		if err := l.setInterfaces(ifis); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Rejoin renews the memberships of all groups on ifi, which replaces the
+// interface of the same index or name. This is needed after an interface
+// came back up or was recreated.
+func (d *Dispatcher) Rejoin(ifi *net.Interface) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	i := slices.IndexFunc(d.ifis, func(o *net.Interface) bool {
+		return o.Index == ifi.Index || o.Name == ifi.Name
+	})
+	if i < 0 {
+		return nil
+	}
+
+	d.ifis = slices.Clone(d.ifis)
+	d.ifis[i] = ifi
+
+	var errs []error
+
+	for _, l := range d.listeners {
+		if err := l.rejoin(ifi); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewDispatcher creates a dispatcher that joins groups on ifis.
+func NewDispatcher(ifis []*net.Interface, opts ...Opt) *Dispatcher {
+	d := &Dispatcher{
 		ifis:      ifis,
-		listeners: make(map[int]*listener),
+		logger:    slog.Default(),
+		listeners: make(map[listenerKey]*listener),
 	}
+
+	for _, opt := range opts {
+		opt.apply(d)
+	}
+
+	return d
+}
+
+// dispatch runs the callback of c in a goroutine of its own. With a
+// concurrency limit, it blocks the calling read loop of the listener while
+// the limit is reached, so further packets queue up in the socket's receive
+// buffer and are dropped by the kernel once it is full.
+func (d *Dispatcher) dispatch(c *Consumer, b []byte, src net.Addr, path string) {
+	if d.sem == nil {
+		go c.cb(b, src, path)
+		return
+	}
+
+	d.sem <- struct{}{}
+
+	go func() {
+		defer func() { <-d.sem }()
+
+		c.cb(b, src, path)
+	}()
 }
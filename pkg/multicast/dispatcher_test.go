@@ -0,0 +1,308 @@
+package multicast
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_Rejoin(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	d := NewDispatcher([]*net.Interface{lo})
+	defer d.Close()
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 1, 2), Port: 19123}
+	received := make(chan struct{}, 16)
+
+	if _, err := d.AddConsumer(group, func([]byte, net.Addr, string) {
+		received <- struct{}{}
+	}); err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	if err := d.Rejoin(lo); err != nil {
+		t.Fatalf("failed to rejoin: %v", err)
+	}
+
+	// Interfaces the dispatcher does not use are ignored
+	if err := d.Rejoin(&net.Interface{Index: 9999, Name: "unknown0"}); err != nil {
+		t.Fatalf("failed to ignore unknown interface: %v", err)
+	}
+
+	pcs, err := OpenPacketConns(NetworkIPv4, []*net.Interface{lo}, 0, SocketOptions{})
+	if err != nil {
+		t.Fatalf("failed to open packet conn: %v", err)
+	}
+
+	defer pcs[0].Close()
+
+	if _, err := pcs[0].WriteTo([]byte("foo"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("packet not received after rejoin")
+	}
+}
+
+// igmpGroups returns the IPv4 groups joined on ifname according to the
+// kernel.
+func igmpGroups(t *testing.T, ifname string) []string {
+	t.Helper()
+
+	b, err := os.ReadFile("/proc/net/igmp")
+	if err != nil {
+		t.Skipf("cannot read joined groups: %v", err)
+	}
+
+	var (
+		groups  []string
+		current string
+	)
+
+	for _, line := range strings.Split(string(b), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") {
+			current = fields[1]
+			continue
+		}
+
+		if current != ifname {
+			continue
+		}
+
+		// The group is printed in host byte order.
+		g, err := hex.DecodeString(fields[0])
+		if err != nil || len(g) != net.IPv4len {
+			continue
+		}
+
+		slices.Reverse(g)
+		groups = append(groups, net.IP(g).String())
+	}
+
+	return groups
+}
+
+func TestDispatcher_LeaveGroup(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	d := NewDispatcher([]*net.Interface{lo})
+	defer d.Close()
+
+	// Both groups share a listener, which stays open while either is used.
+	group1 := &net.UDPAddr{IP: net.IPv4(239, 255, 1, 3), Port: 19124}
+	group2 := &net.UDPAddr{IP: net.IPv4(239, 255, 1, 4), Port: 19124}
+
+	cb := func([]byte, net.Addr, string) {}
+
+	c1, err := d.AddConsumer(group1, cb)
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	c2, err := d.AddConsumer(group1, cb)
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	c3, err := d.AddConsumer(group2, cb)
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	defer c3.Close()
+
+	if groups := igmpGroups(t, "lo"); !slices.Contains(groups, "239.255.1.3") || !slices.Contains(groups, "239.255.1.4") {
+		t.Fatalf("expected both groups to be joined, got %v", groups)
+	}
+
+	c1.Close()
+
+	if groups := igmpGroups(t, "lo"); !slices.Contains(groups, "239.255.1.3") {
+		t.Errorf("expected group to stay joined while in use, got %v", groups)
+	}
+
+	c2.Close()
+
+	if groups := igmpGroups(t, "lo"); slices.Contains(groups, "239.255.1.3") || !slices.Contains(groups, "239.255.1.4") {
+		t.Errorf("expected only the unused group to be left, got %v", groups)
+	}
+}
+
+// mcfilterSources returns the sources joined for group on ifname according
+// to the kernel.
+func mcfilterSources(t *testing.T, ifname string, group net.IP) []string {
+	t.Helper()
+
+	b, err := os.ReadFile("/proc/net/mcfilter")
+	if err != nil {
+		t.Skipf("cannot read joined sources: %v", err)
+	}
+
+	var sources []string
+
+	for _, line := range strings.Split(string(b), "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[1] != ifname {
+			continue
+		}
+
+		// Group and source are printed as numbers in network byte order.
+		g, err := hex.DecodeString(strings.TrimPrefix(fields[2], "0x"))
+		if err != nil || !net.IP(g).Equal(group) {
+			continue
+		}
+
+		s, err := hex.DecodeString(strings.TrimPrefix(fields[3], "0x"))
+		if err != nil || len(s) != net.IPv4len {
+			continue
+		}
+
+		sources = append(sources, net.IP(s).String())
+	}
+
+	slices.Sort(sources)
+
+	return sources
+}
+
+func TestDispatcher_SourceSpecific(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	d := NewDispatcher([]*net.Interface{lo})
+	defer d.Close()
+
+	group := &net.UDPAddr{IP: net.IPv4(232, 1, 1, 1), Port: 19125}
+	cb := func([]byte, net.Addr, string) {}
+
+	if _, err := d.AddConsumer(&net.UDPAddr{IP: net.IPv4(239, 255, 1, 5), Port: 19125}, cb, net.IPv4(127, 0, 0, 1)); !errors.Is(err, ErrNotSourceSpecific) {
+		t.Errorf("expected ErrNotSourceSpecific, got %v", err)
+	}
+
+	if _, err := d.AddConsumer(group, cb, net.ParseIP("::1")); !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("expected ErrInvalidSource, got %v", err)
+	}
+
+	c1, err := d.AddConsumer(group, cb, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	c2, err := d.AddConsumer(group, cb, net.IPv4(127, 0, 0, 1), net.IPv4(127, 0, 0, 2))
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	if sources := mcfilterSources(t, "lo", group.IP); !slices.Equal(sources, []string{"127.0.0.1", "127.0.0.2"}) {
+		t.Fatalf("expected both sources to be joined, got %v", sources)
+	}
+
+	// A socket cannot be member of a group for any source as well.
+	if _, err := d.AddConsumer(group, cb); !errors.Is(err, ErrMembershipConflict) {
+		t.Errorf("expected ErrMembershipConflict, got %v", err)
+	}
+
+	// Sources stay joined while another consumer uses them.
+	c2.Close()
+
+	if sources := mcfilterSources(t, "lo", group.IP); !slices.Equal(sources, []string{"127.0.0.1"}) {
+		t.Errorf("expected only the shared source to stay joined, got %v", sources)
+	}
+
+	c1.Close()
+
+	if sources := mcfilterSources(t, "lo", group.IP); len(sources) != 0 {
+		t.Errorf("expected all sources to be left, got %v", sources)
+	}
+
+	// Without source-specific consumers, the group is free for any source.
+	c3, err := d.AddConsumer(group, cb)
+	if err != nil {
+		t.Fatalf("failed to add any-source consumer: %v", err)
+	}
+
+	c3.Close()
+}
+
+func TestDispatcher_SourceSpecificRollback(t *testing.T) {
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	b, err := os.ReadFile("/proc/sys/net/ipv4/igmp_max_msf")
+	if err != nil {
+		t.Skipf("cannot read source limit: %v", err)
+	}
+
+	limit, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || limit > 250 {
+		t.Skipf("unusable source limit %q", b)
+	}
+
+	d := NewDispatcher([]*net.Interface{lo})
+	defer d.Close()
+
+	group := &net.UDPAddr{IP: net.IPv4(232, 1, 1, 2), Port: 19126}
+	cb := func([]byte, net.Addr, string) {}
+
+	c1, err := d.AddConsumer(group, cb, net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatalf("failed to add consumer: %v", err)
+	}
+
+	// One source more than the kernel allows per socket makes the last
+	// join fail, after the others succeeded.
+	var sources []net.IP
+	for i := range limit + 1 {
+		sources = append(sources, net.IPv4(127, 0, 0, byte(i+1)))
+	}
+
+	if _, err := d.AddConsumer(group, cb, sources...); err == nil {
+		t.Fatal("expected joining too many sources to fail")
+	}
+
+	if joined := mcfilterSources(t, "lo", group.IP); !slices.Equal(joined, []string{"127.0.0.1"}) {
+		t.Errorf("expected the sources joined so far to be left again, got %v", joined)
+	}
+
+	// The reference of the shared source was dropped as well, so closing
+	// its remaining consumer leaves it.
+	c1.Close()
+
+	if joined := mcfilterSources(t, "lo", group.IP); len(joined) != 0 {
+		t.Errorf("expected all sources to be left, got %v", joined)
+	}
+}
+
+func TestDispatcher_NilLogger(t *testing.T) {
+	d := NewDispatcher(nil, Logger(nil))
+	defer d.Close()
+
+	if d.logger == nil {
+		t.Error("expected a nil logger to keep the default")
+	}
+}
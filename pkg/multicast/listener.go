@@ -3,12 +3,10 @@ package multicast
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net"
 	"slices"
 	"sync"
-
-	"github.com/rs/zerolog/log"
-	"golang.org/x/net/ipv4"
 )
 
 const (
@@ -18,15 +16,19 @@ const (
 type listener struct {
 	mutex sync.Mutex
 
-	ipv4PacketConn *ipv4.PacketConn
-	ifis           []*net.Interface
+	pc     *PacketConn
+	ifis   []*net.Interface
+	logger *slog.Logger
 
 	streams map[string]consumers
+
+	// Reference counts of the sources joined per group
+	sources map[string]map[string]int
 }
 
 func (l *listener) close() {
-	if err := l.ipv4PacketConn.Close(); err != nil {
-		log.Warn().Err(err).Msg("failed to close ipv4 packet conn")
+	if err := l.pc.Close(); err != nil {
+		l.logger.Warn("failed to close packet conn", "error", err)
 	}
 }
 
@@ -36,25 +38,93 @@ func (l *listener) addConsumer(c *Consumer) error {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
 
-	if _, ok := l.streams[k]; !ok {
-		l.streams[k] = make(consumers, 0)
+	cs, ok := l.streams[k]
+
+	// A socket can either be member of a group for any source or for a set
+	// of sources, but not both.
+	if ok && len(cs) > 0 && (len(cs[0].sources) > 0) != (len(c.sources) > 0) {
+		return fmt.Errorf("%w: %s", ErrMembershipConflict, c.addr.IP)
+	}
+
+	if len(c.sources) > 0 {
+		if err := l.joinSources(c); err != nil {
+			return err
+		}
+	} else if !ok {
+		for i, ifi := range l.ifis {
+			if err := l.pc.JoinGroup(ifi, c.addr); err != nil {
+				for _, joined := range l.ifis[:i] {
+					l.pc.LeaveGroup(joined, c.addr)
+				}
 
-		for _, ifi := range l.ifis {
-			if err := l.ipv4PacketConn.JoinGroup(ifi, c.addr); err != nil {
 				return fmt.Errorf("failed to join group %s on %s: %w", c.addr, ifi.Name, err)
 			}
 		}
 	}
 
-	l.streams[k] = append(l.streams[k], c)
+	l.streams[k] = append(cs, c)
 
-	log.Info().Str("addr", c.addr.String()).Msg("added consumer")
+	l.logger.Debug("added consumer", "group", c.addr)
 
 	return nil
 }
 
+func (l *listener) joinSources(c *Consumer) error {
+	k := c.addr.IP.String()
+
+	if _, ok := l.sources[k]; !ok {
+		l.sources[k] = make(map[string]int)
+	}
+
+	for i, source := range c.sources {
+		if l.sources[k][source.String()] == 0 {
+			for j, ifi := range l.ifis {
+				if err := l.pc.JoinSourceSpecificGroup(ifi, c.addr, &net.UDPAddr{IP: source}); err != nil {
+					for _, joined := range l.ifis[:j] {
+						l.pc.LeaveSourceSpecificGroup(joined, c.addr, &net.UDPAddr{IP: source})
+					}
+
+					// Drop the references taken for the sources joined so far
+					l.leaveSources(&Consumer{addr: c.addr, sources: c.sources[:i]})
+
+					return fmt.Errorf("failed to join group %s for source %s on %s: %w", c.addr, source, ifi.Name, err)
+				}
+			}
+		}
+
+		l.sources[k][source.String()]++
+	}
+
+	return nil
+}
+
+func (l *listener) leaveSources(c *Consumer) {
+	k := c.addr.IP.String()
+
+	for _, source := range c.sources {
+		l.sources[k][source.String()]--
+
+		if l.sources[k][source.String()] > 0 {
+			continue
+		}
+
+		delete(l.sources[k], source.String())
+
+		for _, ifi := range l.ifis {
+			if err := l.pc.LeaveSourceSpecificGroup(ifi, c.addr, &net.UDPAddr{IP: source}); err != nil {
+				l.logger.Error("failed to leave source-specific group",
+					"group", c.addr, "source", source, "interface", ifi.Name, "error", err)
+			}
+		}
+	}
+
+	if len(l.sources[k]) == 0 {
+		delete(l.sources, k)
+	}
+}
+
 func (l *listener) removeConsumer(c *Consumer) {
-	k := c.addr.String()
+	k := c.addr.IP.String()
 
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
@@ -64,25 +134,151 @@ func (l *listener) removeConsumer(c *Consumer) {
 		return
 	}
 
-	for i, cc := range cs {
-		if cc == c {
-			l.streams[k] = slices.Delete(cs, i, i+1)
+	i := slices.Index(cs, c)
+	if i < 0 {
+		return
+	}
 
-			break
-		}
+	l.streams[k] = slices.Delete(cs, i, i+1)
+
+	if len(c.sources) > 0 {
+		l.leaveSources(c)
 	}
 
 	if len(l.streams[k]) == 0 {
 		delete(l.streams, k)
 
+		if len(c.sources) > 0 {
+			return
+		}
+
 		for _, ifi := range l.ifis {
-			if err := l.ipv4PacketConn.LeaveGroup(ifi, c.addr); err != nil {
-				log.Error().Err(err).Msg("failed to leave group")
+			if err := l.pc.LeaveGroup(ifi, c.addr); err != nil {
+				l.logger.Error("failed to leave group", "group", c.addr, "interface", ifi.Name, "error", err)
 			}
 		}
 	}
 }
 
+// rejoin renews all memberships on ifi, which replaces the interface with
+// the same index or name. The kernel drops memberships when an interface
+// goes away, and they may be stale after it comes back.
+func (l *listener) rejoin(ifi *net.Interface) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	i := slices.IndexFunc(l.ifis, func(o *net.Interface) bool {
+		return o.Index == ifi.Index || o.Name == ifi.Name
+	})
+	if i < 0 {
+		return nil
+	}
+
+	old := l.ifis[i]
+	l.ifis[i] = ifi
+
+	var errs []error
+
+	for k, cs := range l.streams {
+		group := cs[0].addr
+
+		if len(cs[0].sources) == 0 {
+			// Leaving fails if the membership is already gone, which is fine.
+			l.pc.LeaveGroup(old, group)
+
+			if err := l.pc.JoinGroup(ifi, group); err != nil {
+				errs = append(errs, fmt.Errorf("failed to join group %s on %s: %w", group, ifi.Name, err))
+			}
+
+			continue
+		}
+
+		for source := range l.sources[k] {
+			src := &net.UDPAddr{IP: net.ParseIP(source)}
+
+			l.pc.LeaveSourceSpecificGroup(old, group, src)
+
+			if err := l.pc.JoinSourceSpecificGroup(ifi, group, src); err != nil {
+				errs = append(errs, fmt.Errorf("failed to join group %s for source %s on %s: %w", group, source, ifi.Name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// setInterfaces moves all memberships to the interfaces ifis, leaving the
+// groups on interfaces that are no longer used and joining them on new ones.
+func (l *listener) setInterfaces(ifis []*net.Interface) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	contains := func(ifis []*net.Interface, ifi *net.Interface) bool {
+		return slices.ContainsFunc(ifis, func(o *net.Interface) bool {
+			return o.Index == ifi.Index
+		})
+	}
+
+	var errs []error
+
+	for k, cs := range l.streams {
+		group := cs[0].addr
+
+		var sources []*net.UDPAddr
+		for source := range l.sources[k] {
+			sources = append(sources, &net.UDPAddr{IP: net.ParseIP(source)})
+		}
+
+		for _, ifi := range l.ifis {
+			if contains(ifis, ifi) {
+				continue
+			}
+
+			if len(cs[0].sources) == 0 {
+				l.pc.LeaveGroup(ifi, group)
+			}
+
+			for _, src := range sources {
+				l.pc.LeaveSourceSpecificGroup(ifi, group, src)
+			}
+		}
+
+		for _, ifi := range ifis {
+			if contains(l.ifis, ifi) {
+				continue
+			}
+
+			if len(cs[0].sources) == 0 {
+				if err := l.pc.JoinGroup(ifi, group); err != nil {
+					errs = append(errs, fmt.Errorf("failed to join group %s on %s: %w", group, ifi.Name, err))
+				}
+			}
+
+			for _, src := range sources {
+				if err := l.pc.JoinSourceSpecificGroup(ifi, group, src); err != nil {
+					errs = append(errs, fmt.Errorf("failed to join group %s for source %s on %s: %w", group, src.IP, ifi.Name, err))
+				}
+			}
+		}
+	}
+
+	l.ifis = slices.Clone(ifis)
+
+	return errors.Join(errs...)
+}
+
+// path names the way a packet took by the interface it arrived on and
+// the network, as in "eth0/udp4".
+func (l *listener) path(ifIndex int) string {
+	for _, ifi := range l.ifis {
+		if ifi.Index == ifIndex {
+			return ifi.Name + "/" + l.pc.Network()
+		}
+	}
+
+	return fmt.Sprintf("%d/%s", ifIndex, l.pc.Network())
+}
+
 func (l *listener) hasConsumers() bool {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
@@ -90,49 +286,57 @@ func (l *listener) hasConsumers() bool {
 	return len(l.streams) > 0
 }
 
-func newListener(port int, ifis []*net.Interface) (*listener, error) {
-	pc, err := OpenPacketConn(port, "")
+func newListener(network string, port int, d *Dispatcher) (*listener, error) {
+	pc, err := OpenPacketConn(network, port, "", d.options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open packet conn: %w", err)
 	}
 
-	if err := pc.SetControlMessage(ipv4.FlagDst, true); err != nil {
+	if err := pc.enableDestination(); err != nil {
+		pc.Close()
 		return nil, fmt.Errorf("failed to set control message: %w", err)
 	}
 
 	l := &listener{
-		ipv4PacketConn: pc,
-		streams:        make(map[string]consumers),
-		ifis:           ifis,
+		pc:      pc,
+		streams: make(map[string]consumers),
+		sources: make(map[string]map[string]int),
+		ifis:    slices.Clone(d.ifis),
+		logger:  d.logger.With("network", network, "port", port),
 	}
 
 	go func() {
 		buf := make([]byte, maxMTU)
 
 		for {
-			n, cm, _, err := pc.ReadFrom(buf)
+			n, dst, ifIndex, src, err := pc.ReadFrom(buf)
 			if err != nil {
 				if !errors.Is(err, net.ErrClosed) {
-					log.Error().Err(err).Msg("failed to read from packet conn")
+					l.logger.Error("failed to read from packet conn", "error", err)
 				}
 
 				return
 			}
 
-			k := cm.Dst.String()
+			k := dst.String()
 
 			l.mutex.Lock()
+			cs := slices.Clone(l.streams[k])
+			path := l.path(ifIndex)
+			l.mutex.Unlock()
 
-			if cs, ok := l.streams[k]; ok {
-				for _, c := range cs {
-					newBuf := make([]byte, n)
-					copy(newBuf, buf[:n])
-
-					go c.cb(newBuf)
+			// Dispatching may block, so it must not hold the lock that
+			// callbacks need to add or remove consumers.
+			for _, c := range cs {
+				if !c.accepts(src) {
+					continue
 				}
-			}
 
-			l.mutex.Unlock()
+				newBuf := make([]byte, n)
+				copy(newBuf, buf[:n])
+
+				d.dispatch(c, newBuf, src, path)
+			}
 		}
 	}()
 
@@ -0,0 +1,110 @@
+package multicast
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+var (
+	ErrInvalidSocketOption = errors.New("invalid socket option")
+)
+
+// SocketOptions configures the sockets that are opened. The zero value keeps
+// the kernel defaults.
+type SocketOptions struct {
+	// TTL is the IPv4 TTL or IPv6 hop limit of outgoing multicast packets.
+	TTL int
+
+	// DisableLoopback keeps outgoing multicast packets from being delivered
+	// to sockets on the same host.
+	DisableLoopback bool
+
+	// TOS is the IPv4 type of service or IPv6 traffic class of outgoing
+	// packets. The DSCP occupies its upper six bits.
+	TOS int
+
+	// ReceiveBuffer and SendBuffer set SO_RCVBUF and SO_SNDBUF.
+	ReceiveBuffer int
+	SendBuffer    int
+
+	// ReusePort sets SO_REUSEPORT, which lets other processes bind the same
+	// port.
+	ReusePort bool
+}
+
+func (o SocketOptions) Validate() error {
+	if o.TTL < 0 || o.TTL > 255 {
+		return fmt.Errorf("%w: TTL %d", ErrInvalidSocketOption, o.TTL)
+	}
+
+	if o.TOS < 0 || o.TOS > 255 {
+		return fmt.Errorf("%w: TOS %d", ErrInvalidSocketOption, o.TOS)
+	}
+
+	if o.ReceiveBuffer < 0 {
+		return fmt.Errorf("%w: receive buffer size %d", ErrInvalidSocketOption, o.ReceiveBuffer)
+	}
+
+	if o.SendBuffer < 0 {
+		return fmt.Errorf("%w: send buffer size %d", ErrInvalidSocketOption, o.SendBuffer)
+	}
+
+	return nil
+}
+
+type Opt interface {
+	apply(*Dispatcher)
+}
+
+type OptSocket struct {
+	options SocketOptions
+}
+
+// Socket sets the options of the sockets the dispatcher opens.
+func Socket(o SocketOptions) Opt {
+	return &OptSocket{
+		options: o,
+	}
+}
+
+func (o *OptSocket) apply(d *Dispatcher) {
+	d.options = o.options
+}
+
+type OptConcurrency struct {
+	concurrency int
+}
+
+// Concurrency limits the number of callbacks that run at the same time.
+// Zero means no limit. While the limit is reached, listeners stop reading,
+// and packets that do not fit into the receive buffer are dropped.
+func Concurrency(n int) Opt {
+	return &OptConcurrency{
+		concurrency: n,
+	}
+}
+
+func (o *OptConcurrency) apply(d *Dispatcher) {
+	if o.concurrency > 0 {
+		d.sem = make(chan struct{}, o.concurrency)
+	}
+}
+
+type OptLogger struct {
+	logger *slog.Logger
+}
+
+// Logger sets the logger. It defaults to slog.Default(), which a nil logger
+// keeps.
+func Logger(l *slog.Logger) Opt {
+	return &OptLogger{
+		logger: l,
+	}
+}
+
+func (o *OptLogger) apply(d *Dispatcher) {
+	if o.logger != nil {
+		d.logger = o.logger
+	}
+}
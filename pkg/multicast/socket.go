@@ -1,65 +1,202 @@
 package multicast
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"net"
 	"os"
 	"syscall"
 
-	"golang.org/x/net/ipv4"
+	"golang.org/x/sys/unix"
 )
 
-func OpenPacketConn(port int, ifname string) (*ipv4.PacketConn, error) {
-	s, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
+var (
+	ErrUnknownNetwork = errors.New("unknown network")
+)
+
+// SocketError describes a failure to set up a socket. Err is the
+// underlying error, such as syscall.EPERM or syscall.ENODEV.
+type SocketError struct {
+	Op        string
+	Network   string
+	Port      int
+	Interface string
+	Err       error
+}
+
+func (e *SocketError) Error() string {
+	s := fmt.Sprintf("%s %s port %d", e.Op, e.Network, e.Port)
+
+	if e.Interface != "" {
+		s += " on " + e.Interface
+	}
+
+	return s + ": " + e.Err.Error()
+}
+
+func (e *SocketError) Unwrap() error {
+	return e.Err
+}
+
+// OpenPacketConn opens a socket bound to port, and to the interface ifname
+// unless it is empty.
+func OpenPacketConn(network string, port int, ifname string, o SocketOptions) (*PacketConn, error) {
+	var family int
+
+	switch network {
+	case NetworkIPv4:
+		family = syscall.AF_INET
+	case NetworkIPv6:
+		family = syscall.AF_INET6
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownNetwork, network)
+	}
+
+	s, err := syscall.Socket(family, syscall.SOCK_DGRAM, syscall.IPPROTO_UDP)
 	if err != nil {
-		return nil, fmt.Errorf("socket syscall failed: %w", err)
+		return nil, &SocketError{Op: "socket", Network: network, Port: port, Interface: ifname, Err: err}
+	}
+
+	// fail closes the socket and describes the step that failed
+	fail := func(op string, err error) (*PacketConn, error) {
+		syscall.Close(s)
+
+		return nil, &SocketError{Op: op, Network: network, Port: port, Interface: ifname, Err: err}
 	}
 
 	if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
-		return nil, fmt.Errorf("failed to set SO_REUSEADDR: %w", err)
+		return fail("set SO_REUSEADDR", err)
+	}
+
+	// Only deliver traffic of groups joined on this very socket. Otherwise, the kernel
+	// hands us every group joined by any socket on the host that shares the port.
+	if family == syscall.AF_INET {
+		if err := syscall.SetsockoptInt(s, unix.IPPROTO_IP, unix.IP_MULTICAST_ALL, 0); err != nil {
+			return fail("reset IP_MULTICAST_ALL", err)
+		}
+	} else {
+		if err := syscall.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_V6ONLY, 1); err != nil {
+			return fail("set IPV6_V6ONLY", err)
+		}
+
+		// IPV6_MULTICAST_ALL is only available since Linux 4.20.
+		if err := syscall.SetsockoptInt(s, unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_ALL, 0); err != nil && !errors.Is(err, syscall.ENOPROTOOPT) {
+			return fail("reset IPV6_MULTICAST_ALL", err)
+		}
+	}
+
+	if o.ReusePort {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+			return fail("set SO_REUSEPORT", err)
+		}
+	}
+
+	if o.ReceiveBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fail("set SO_RCVBUF", err)
+		}
 	}
 
-	// if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1); err != nil {
-	// 	return nil, fmt.Errorf("failed to set SO_REUSEPORT: %w", err)
-	// }
+	if o.SendBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fail("set SO_SNDBUF", err)
+		}
+	}
+
+	if op, err := setMulticastOptions(s, family, o); err != nil {
+		return fail(op, err)
+	}
 
 	if len(ifname) > 0 {
 		if err := syscall.SetsockoptString(s, syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, ifname); err != nil {
-			log.Fatal(err)
+			return fail("bind to device", err)
 		}
 	}
 
-	lsa := syscall.SockaddrInet4{Port: port}
-	// copy(lsa.Addr[:], bindAddr.To4())
+	var lsa syscall.Sockaddr
 
-	if err := syscall.Bind(s, &lsa); err != nil {
-		syscall.Close(s)
-		log.Fatal(err)
+	if family == syscall.AF_INET {
+		lsa = &syscall.SockaddrInet4{Port: port}
+	} else {
+		lsa = &syscall.SockaddrInet6{Port: port}
 	}
 
+	if err := syscall.Bind(s, lsa); err != nil {
+		return fail("bind", err)
+	}
+
+	// The file owns the socket from here on; FilePacketConn works on a duplicate.
 	f := os.NewFile(uintptr(s), "")
 	c, err := net.FilePacketConn(f)
 	f.Close()
 
 	if err != nil {
-		log.Fatal(err)
+		return nil, &SocketError{Op: "file packet conn", Network: network, Port: port, Interface: ifname, Err: err}
+	}
+
+	return newPacketConn(network, c), nil
+}
+
+// setMulticastOptions applies the options concerning outgoing packets and
+// returns the name of the option that failed, if any.
+func setMulticastOptions(s, family int, o SocketOptions) (string, error) {
+	level, ttl, loop, tos := unix.IPPROTO_IP, unix.IP_MULTICAST_TTL, unix.IP_MULTICAST_LOOP, unix.IP_TOS
+	if family == syscall.AF_INET6 {
+		level, ttl, loop, tos = unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, unix.IPV6_MULTICAST_LOOP, unix.IPV6_TCLASS
+	}
+
+	if o.TTL > 0 {
+		if err := syscall.SetsockoptInt(s, level, ttl, o.TTL); err != nil {
+			return "set multicast TTL", err
+		}
+	}
+
+	if o.DisableLoopback {
+		if err := syscall.SetsockoptInt(s, level, loop, 0); err != nil {
+			return "disable multicast loopback", err
+		}
+	}
+
+	if o.TOS > 0 {
+		if err := syscall.SetsockoptInt(s, level, tos, o.TOS); err != nil {
+			return "set TOS", err
+		}
 	}
 
-	return ipv4.NewPacketConn(c), nil
+	return "", nil
 }
 
-func OpenPacketConns(ifis []*net.Interface, port int) ([]*ipv4.PacketConn, error) {
-	var pcs []*ipv4.PacketConn
+func OpenPacketConns(network string, ifis []*net.Interface, port int, o SocketOptions) ([]*PacketConn, error) {
+	var pcs []*PacketConn
 
 	for _, ifi := range ifis {
-		p, err := OpenPacketConn(port, ifi.Name)
+		p, err := OpenPacketConn(network, port, ifi.Name, o)
 		if err != nil {
+			closePacketConns(pcs)
 			return nil, err
 		}
 
+		if err := p.SetMulticastInterface(ifi); err != nil {
+			p.Close()
+			closePacketConns(pcs)
+
+			return nil, &SocketError{
+				Op:        "set multicast interface",
+				Network:   network,
+				Port:      port,
+				Interface: ifi.Name,
+				Err:       err,
+			}
+		}
+
 		pcs = append(pcs, p)
 	}
 
 	return pcs, nil
 }
+
+func closePacketConns(pcs []*PacketConn) {
+	for _, pc := range pcs {
+		pc.Close()
+	}
+}
@@ -0,0 +1,68 @@
+package multicast
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOpenPacketConn_UnknownInterface(t *testing.T) {
+	_, err := OpenPacketConn(NetworkIPv4, 0, "does-not-exist0", SocketOptions{})
+
+	var se *SocketError
+	if !errors.As(err, &se) {
+		t.Fatalf("expected socket error, got %v", err)
+	}
+
+	if se.Interface != "does-not-exist0" {
+		t.Errorf("expected interface in error, got %q", se.Interface)
+	}
+}
+
+func TestOpenPacketConn_UnknownNetwork(t *testing.T) {
+	if _, err := OpenPacketConn("udp", 0, "", SocketOptions{}); !errors.Is(err, ErrUnknownNetwork) {
+		t.Errorf("expected unknown network error, got %v", err)
+	}
+}
+
+func TestOpenPacketConn_Options(t *testing.T) {
+	pc, err := OpenPacketConn(NetworkIPv4, 0, "", SocketOptions{
+		TTL:             7,
+		DisableLoopback: true,
+		TOS:             46 << 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to open packet conn: %v", err)
+	}
+
+	defer pc.Close()
+
+	if ttl, err := pc.v4.MulticastTTL(); err != nil || ttl != 7 {
+		t.Errorf("expected TTL 7, got %d (%v)", ttl, err)
+	}
+
+	if loop, err := pc.v4.MulticastLoopback(); err != nil || loop {
+		t.Errorf("expected loopback to be disabled, got %v (%v)", loop, err)
+	}
+
+	if tos, err := pc.v4.TOS(); err != nil || tos != 46<<2 {
+		t.Errorf("expected TOS %d, got %d (%v)", 46<<2, tos, err)
+	}
+}
+
+func TestSocketOptions_Validate(t *testing.T) {
+	for _, o := range []SocketOptions{
+		{TTL: -1},
+		{TTL: 256},
+		{TOS: 256},
+		{ReceiveBuffer: -1},
+		{SendBuffer: -1},
+	} {
+		if err := o.Validate(); !errors.Is(err, ErrInvalidSocketOption) {
+			t.Errorf("expected %+v to be invalid, got %v", o, err)
+		}
+	}
+
+	if err := (SocketOptions{TTL: 255, TOS: 255}).Validate(); err != nil {
+		t.Errorf("expected options to be valid, got %v", err)
+	}
+}
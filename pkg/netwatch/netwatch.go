@@ -0,0 +1,275 @@
+// Package netwatch reports changes of network interfaces and their addresses
+// as announced by the kernel via rtnetlink.
+package netwatch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+type EventType int
+
+const (
+	// LinkUp is reported when an interface appears, comes up, or is renamed
+	// while it is up.
+	LinkUp EventType = iota
+	LinkDown
+	LinkRemoved
+	AddressAdded
+	AddressRemoved
+)
+
+func (t EventType) String() string {
+	switch t {
+	case LinkUp:
+		return "link up"
+	case LinkDown:
+		return "link down"
+	case LinkRemoved:
+		return "link removed"
+	case AddressAdded:
+		return "address added"
+	case AddressRemoved:
+		return "address removed"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(t))
+	}
+}
+
+type Event struct {
+	Type  EventType
+	Index int
+
+	// Name is only known for link events.
+	Name string
+
+	// Addr is only set for address events.
+	Addr net.IP
+}
+
+func (e Event) String() string {
+	s := fmt.Sprintf("%s: interface %d", e.Type, e.Index)
+
+	if e.Name != "" {
+		s += " (" + e.Name + ")"
+	}
+
+	if e.Addr != nil {
+		s += " address " + e.Addr.String()
+	}
+
+	return s
+}
+
+// Watcher listens to link and address changes.
+type Watcher struct {
+	f      *os.File
+	events chan Event
+
+	// Last known state of the links, to tell changes from repetitions
+	links map[int]link
+}
+
+type link struct {
+	name string
+	up   bool
+}
+
+// New opens a netlink socket and starts watching. Events are delivered on
+// the channel returned by Events until Close is called.
+func New() (*Watcher, error) {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.NETLINK_ROUTE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+
+	sa := &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_LINK | unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}
+
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	w := &Watcher{
+		// The socket is non-blocking, so reads go through the runtime
+		// poller and are interrupted by Close.
+		f:      os.NewFile(uintptr(fd), "netlink"),
+		events: make(chan Event, 64),
+		links:  make(map[int]link),
+	}
+
+	// Seed the link state, so that the first change of an existing link is
+	// not mistaken for its appearance.
+	if ifis, err := net.Interfaces(); err == nil {
+		for _, ifi := range ifis {
+			w.links[ifi.Index] = link{
+				name: ifi.Name,
+				up:   ifi.Flags&net.FlagUp != 0,
+			}
+		}
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+func (w *Watcher) Close() error {
+	return w.f.Close()
+}
+
+func (w *Watcher) run() {
+	defer close(w.events)
+
+	buf := make([]byte, 1<<16)
+
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			// The kernel drops messages if we are too slow. Nothing to do
+			// about those, but the socket is still usable.
+			if errors.Is(err, syscall.ENOBUFS) {
+				continue
+			}
+
+			return
+		}
+
+		for _, e := range w.parse(buf[:n]) {
+			w.events <- e
+		}
+	}
+}
+
+func (w *Watcher) parse(b []byte) []Event {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil
+	}
+
+	var events []Event
+
+	for _, msg := range msgs {
+		switch msg.Header.Type {
+		case unix.RTM_NEWLINK, unix.RTM_DELLINK:
+			if e, ok := w.parseLink(msg); ok {
+				events = append(events, e)
+			}
+		case unix.RTM_NEWADDR, unix.RTM_DELADDR:
+			if e, ok := parseAddress(msg); ok {
+				events = append(events, e)
+			}
+		}
+	}
+
+	return events
+}
+
+func (w *Watcher) parseLink(msg syscall.NetlinkMessage) (Event, bool) {
+	if len(msg.Data) < unix.SizeofIfInfomsg {
+		return Event{}, false
+	}
+
+	index := int(int32(binary.NativeEndian.Uint32(msg.Data[4:8])))
+	flags := binary.NativeEndian.Uint32(msg.Data[8:12])
+
+	var name string
+
+	if attrs, err := syscall.ParseNetlinkRouteAttr(&msg); err == nil {
+		for _, attr := range attrs {
+			if attr.Attr.Type == unix.IFLA_IFNAME {
+				name = cString(attr.Value)
+			}
+		}
+	}
+
+	e := Event{
+		Index: index,
+		Name:  name,
+	}
+
+	if msg.Header.Type == unix.RTM_DELLINK {
+		delete(w.links, index)
+		e.Type = LinkRemoved
+
+		return e, true
+	}
+
+	old, known := w.links[index]
+	l := link{
+		name: name,
+		up:   flags&unix.IFF_UP != 0,
+	}
+
+	w.links[index] = l
+
+	switch {
+	case l.up && (!known || !old.up || old.name != l.name):
+		e.Type = LinkUp
+	case !l.up && known && old.up:
+		e.Type = LinkDown
+	default:
+		// Some other attribute changed
+		return Event{}, false
+	}
+
+	return e, true
+}
+
+func parseAddress(msg syscall.NetlinkMessage) (Event, bool) {
+	if len(msg.Data) < unix.SizeofIfAddrmsg {
+		return Event{}, false
+	}
+
+	e := Event{
+		Index: int(binary.NativeEndian.Uint32(msg.Data[4:8])),
+		Type:  AddressAdded,
+	}
+
+	if msg.Header.Type == unix.RTM_DELADDR {
+		e.Type = AddressRemoved
+	}
+
+	attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+	if err != nil {
+		return Event{}, false
+	}
+
+	for _, attr := range attrs {
+		switch attr.Attr.Type {
+		case unix.IFA_LOCAL:
+			// On point-to-point links, IFA_ADDRESS is the peer's.
+			e.Addr = net.IP(slices.Clone(attr.Value))
+		case unix.IFA_ADDRESS:
+			if e.Addr == nil {
+				e.Addr = net.IP(slices.Clone(attr.Value))
+			}
+		}
+	}
+
+	return e, true
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+
+	return string(b)
+}
@@ -0,0 +1,101 @@
+package netwatch
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func attr(typ uint16, value []byte) []byte {
+	l := unix.SizeofRtAttr + len(value)
+	b := make([]byte, (l+unix.RTA_ALIGNTO-1) & ^(unix.RTA_ALIGNTO-1))
+
+	binary.NativeEndian.PutUint16(b[0:2], uint16(l))
+	binary.NativeEndian.PutUint16(b[2:4], typ)
+	copy(b[unix.SizeofRtAttr:], value)
+
+	return b
+}
+
+func message(typ uint16, body []byte, attrs ...[]byte) []byte {
+	for _, a := range attrs {
+		body = append(body, a...)
+	}
+
+	b := make([]byte, unix.SizeofNlMsghdr, unix.SizeofNlMsghdr+len(body))
+
+	binary.NativeEndian.PutUint32(b[0:4], uint32(unix.SizeofNlMsghdr+len(body)))
+	binary.NativeEndian.PutUint16(b[4:6], typ)
+
+	return append(b, body...)
+}
+
+func linkMessage(typ uint16, index int, name string, flags uint32) []byte {
+	body := make([]byte, unix.SizeofIfInfomsg)
+	binary.NativeEndian.PutUint32(body[4:8], uint32(index))
+	binary.NativeEndian.PutUint32(body[8:12], flags)
+
+	return message(typ, body, attr(unix.IFLA_IFNAME, append([]byte(name), 0)))
+}
+
+func addressMessage(typ uint16, index int, ip net.IP) []byte {
+	body := make([]byte, unix.SizeofIfAddrmsg)
+	body[0] = unix.AF_INET
+	binary.NativeEndian.PutUint32(body[4:8], uint32(index))
+
+	return message(typ, body, attr(unix.IFA_ADDRESS, ip.To4()), attr(unix.IFA_LOCAL, ip.To4()))
+}
+
+func TestWatcher_Parse(t *testing.T) {
+	w := &Watcher{
+		links: map[int]link{
+			2: {name: "eth0", up: true},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg      []byte
+		expected []Event
+	}{
+		// Repeated state of a known link
+		{linkMessage(unix.RTM_NEWLINK, 2, "eth0", unix.IFF_UP), nil},
+		{linkMessage(unix.RTM_NEWLINK, 2, "eth0", 0), []Event{{Type: LinkDown, Index: 2, Name: "eth0"}}},
+		{linkMessage(unix.RTM_NEWLINK, 2, "eth0", 0), nil},
+		{linkMessage(unix.RTM_NEWLINK, 2, "eth0", unix.IFF_UP), []Event{{Type: LinkUp, Index: 2, Name: "eth0"}}},
+		{linkMessage(unix.RTM_NEWLINK, 2, "lan0", unix.IFF_UP), []Event{{Type: LinkUp, Index: 2, Name: "lan0"}}},
+		{linkMessage(unix.RTM_DELLINK, 2, "lan0", 0), []Event{{Type: LinkRemoved, Index: 2, Name: "lan0"}}},
+		{linkMessage(unix.RTM_NEWLINK, 3, "lan0", unix.IFF_UP), []Event{{Type: LinkUp, Index: 3, Name: "lan0"}}},
+		{addressMessage(unix.RTM_NEWADDR, 3, net.IPv4(192, 0, 2, 1)), []Event{{Type: AddressAdded, Index: 3, Addr: net.IPv4(192, 0, 2, 1)}}},
+		{addressMessage(unix.RTM_DELADDR, 3, net.IPv4(192, 0, 2, 1)), []Event{{Type: AddressRemoved, Index: 3, Addr: net.IPv4(192, 0, 2, 1)}}},
+	} {
+		events := w.parse(tc.msg)
+
+		if len(events) != len(tc.expected) {
+			t.Fatalf("expected %v, got %v", tc.expected, events)
+		}
+
+		for i, e := range events {
+			x := tc.expected[i]
+
+			if e.Type != x.Type || e.Index != x.Index || e.Name != x.Name || !e.Addr.Equal(x.Addr) {
+				t.Errorf("expected %v, got %v", x, e)
+			}
+		}
+	}
+}
+
+func TestWatcher_Close(t *testing.T) {
+	w, err := New()
+	if err != nil {
+		t.Skipf("netlink not available: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	for range w.Events() {
+	}
+}
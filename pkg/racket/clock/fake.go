@@ -0,0 +1,246 @@
+package clock
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when advanced, for deterministic tests.
+type Fake struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock    *Fake
+	deadline time.Time
+	period   time.Duration
+	c        chan time.Time
+	f        func()
+	active   bool
+}
+
+var _ Clock = (*Fake)(nil)
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{
+		now: now,
+	}
+
+	f.cond = sync.NewCond(&f.mutex)
+
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) add(d, period time.Duration, fn func()) *fakeWaiter {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	w := &fakeWaiter{
+		clock:    f,
+		deadline: f.now.Add(d),
+		period:   period,
+		c:        make(chan time.Time, 1),
+		f:        fn,
+		active:   true,
+	}
+
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+
+	return w
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	return &fakeTicker{f.add(d, d, nil)}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return &fakeTimer{f.add(d, 0, nil)}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	return &fakeTimer{f.add(d, 0, fn)}
+}
+
+// Advance moves the clock forward by d and fires all tickers and timers
+// that become due, in order. Functions passed to AfterFunc are called
+// synchronously. Like their real counterparts, tickers drop ticks when
+// their channel is not drained in time.
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+
+	target := f.now.Add(d)
+
+	for {
+		var next *fakeWaiter
+
+		for _, w := range f.waiters {
+			if w.active && !w.deadline.After(target) && (next == nil || w.deadline.Before(next.deadline)) {
+				next = w
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		f.now = next.deadline
+
+		if next.period > 0 {
+			next.deadline = next.deadline.Add(next.period)
+		} else {
+			next.active = false
+		}
+
+		if next.f != nil {
+			f.mutex.Unlock()
+			next.f()
+			f.mutex.Lock()
+
+			continue
+		}
+
+		select {
+		case next.c <- f.now:
+		default:
+		}
+	}
+
+	f.now = target
+	f.removeInactive()
+
+	f.mutex.Unlock()
+}
+
+func (f *Fake) removeInactive() {
+	waiters := f.waiters[:0]
+
+	for _, w := range f.waiters {
+		if w.active {
+			waiters = append(waiters, w)
+		}
+	}
+
+	f.waiters = waiters
+}
+
+// Waiters returns the number of active tickers and timers.
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n := 0
+
+	for _, w := range f.waiters {
+		if w.active {
+			n++
+		}
+	}
+
+	return n
+}
+
+// BlockUntil waits until at least n tickers and timers are active. This
+// allows tests to wait for goroutines to set up their timing before the
+// clock is advanced.
+func (f *Fake) BlockUntil(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for {
+		active := 0
+
+		for _, w := range f.waiters {
+			if w.active {
+				active++
+			}
+		}
+
+		if active >= n {
+			return
+		}
+
+		f.cond.Wait()
+	}
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) stop() bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+
+	wasActive := w.active
+	w.active = false
+	w.clock.removeInactive()
+
+	return wasActive
+}
+
+func (w *fakeWaiter) reset(d time.Duration) bool {
+	w.clock.mutex.Lock()
+	defer w.clock.mutex.Unlock()
+
+	wasActive := w.active
+
+	w.deadline = w.clock.now.Add(d)
+	w.active = true
+
+	if w.period > 0 {
+		w.period = d
+	}
+
+	if !slices.Contains(w.clock.waiters, w) {
+		w.clock.waiters = append(w.clock.waiters, w)
+	}
+
+	w.clock.cond.Broadcast()
+
+	return wasActive
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("non-positive interval for Ticker.Reset")
+	}
+
+	t.reset(d)
+}
+
+func (t *fakeTicker) Stop() {
+	t.stop()
+}
+
+type fakeTimer struct {
+	*fakeWaiter
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	return t.reset(d)
+}
+
+func (t *fakeTimer) Stop() bool {
+	return t.stop()
+}
@@ -0,0 +1,132 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake_Now(t *testing.T) {
+	f := NewFake(epoch)
+
+	f.Advance(time.Minute)
+
+	if got := f.Now(); !got.Equal(epoch.Add(time.Minute)) {
+		t.Errorf("expected %v, got %v", epoch.Add(time.Minute), got)
+	}
+}
+
+func TestFake_Ticker(t *testing.T) {
+	f := NewFake(epoch)
+	ticker := f.NewTicker(time.Second)
+
+	f.Advance(500 * time.Millisecond)
+
+	select {
+	case <-ticker.C():
+		t.Fatal("ticker fired early")
+	default:
+	}
+
+	f.Advance(500 * time.Millisecond)
+
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(epoch.Add(time.Second)) {
+			t.Errorf("expected tick at %v, got %v", epoch.Add(time.Second), tick)
+		}
+	default:
+		t.Fatal("ticker did not fire")
+	}
+
+	// Ticks are dropped if the channel is not drained.
+	f.Advance(3 * time.Second)
+
+	<-ticker.C()
+
+	select {
+	case <-ticker.C():
+		t.Fatal("expected dropped ticks")
+	default:
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+
+	select {
+	case <-ticker.C():
+		t.Fatal("stopped ticker fired")
+	default:
+	}
+
+	if f.Waiters() != 0 {
+		t.Errorf("expected no waiters, got %d", f.Waiters())
+	}
+}
+
+func TestFake_Timer(t *testing.T) {
+	f := NewFake(epoch)
+	timer := f.NewTimer(time.Second)
+
+	f.Advance(2 * time.Second)
+
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("timer did not fire")
+	}
+
+	if timer.Stop() {
+		t.Error("expected Stop to report an expired timer")
+	}
+
+	timer.Reset(time.Second)
+	f.Advance(time.Second)
+
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("timer did not fire after reset")
+	}
+}
+
+func TestFake_AfterFunc(t *testing.T) {
+	f := NewFake(epoch)
+
+	var order []int
+
+	f.AfterFunc(2*time.Second, func() { order = append(order, 2) })
+	f.AfterFunc(time.Second, func() { order = append(order, 1) })
+	stopped := f.AfterFunc(time.Second, func() { order = append(order, 0) })
+
+	if !stopped.Stop() {
+		t.Error("expected Stop to report an active timer")
+	}
+
+	f.Advance(3 * time.Second)
+
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("expected functions to be called in order, got %v", order)
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	f := NewFake(epoch)
+
+	done := make(chan struct{})
+
+	go func() {
+		f.BlockUntil(2)
+		close(done)
+	}()
+
+	f.NewTicker(time.Second)
+	f.NewTimer(time.Second)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("BlockUntil did not return")
+	}
+}
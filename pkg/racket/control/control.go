@@ -0,0 +1,143 @@
+package control
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+// Control messages are exchanged between nodes on a well-known group,
+// separately from the streams. They share a common header of a magic,
+// a version and a type.
+
+var (
+	ErrInvalidMessage = errors.New("invalid control message")
+	ErrUnknownVersion = errors.New("unknown control message version")
+	ErrUnknownType    = errors.New("unknown control message type")
+)
+
+const (
+	magic   = "RKTC"
+	version = 1
+
+	headerSize = len(magic) + 2
+)
+
+type Type uint8
+
+const (
+	TypeAnnouncement Type = iota + 1
+	TypeCatchUp
+)
+
+type Message interface {
+	Type() Type
+	MarshalBinary() ([]byte, error)
+}
+
+func header(t Type) []byte {
+	return append([]byte(magic), version, byte(t))
+}
+
+// Announcement is sent periodically by senders to advertise their
+// multicast pool configuration.
+type Announcement struct {
+	Node        uint64
+	Fingerprint multicastpool.Fingerprint
+	Pool        string
+}
+
+func (a *Announcement) Type() Type {
+	return TypeAnnouncement
+}
+
+func (a *Announcement) MarshalBinary() ([]byte, error) {
+	b := header(TypeAnnouncement)
+	b = binary.BigEndian.AppendUint64(b, a.Node)
+	b = append(b, a.Fingerprint[:]...)
+	b = append(b, a.Pool...)
+
+	return b, nil
+}
+
+func parseAnnouncement(body []byte) (*Announcement, error) {
+	a := &Announcement{}
+
+	if len(body) < 8+len(a.Fingerprint) {
+		return nil, ErrInvalidMessage
+	}
+
+	a.Node = binary.BigEndian.Uint64(body)
+	body = body[8:]
+
+	copy(a.Fingerprint[:], body)
+	body = body[len(a.Fingerprint):]
+
+	a.Pool = string(body)
+
+	return a, nil
+}
+
+// CatchUp is sent by receivers that join a stream, asking the senders to
+// resend the messages matching Subject right away instead of at their next
+// interval.
+type CatchUp struct {
+	Stream  stream.Stream
+	Subject subject.Subject
+}
+
+func (c *CatchUp) Type() Type {
+	return TypeCatchUp
+}
+
+func (c *CatchUp) MarshalBinary() ([]byte, error) {
+	b := header(TypeCatchUp)
+	b = append(b, c.Stream...)
+	b = append(b, 0)
+	b = append(b, c.Subject.String()...)
+
+	return b, nil
+}
+
+func parseCatchUp(body []byte) (*CatchUp, error) {
+	s, subj, ok := bytes.Cut(body, []byte{0})
+	if !ok || len(s) == 0 {
+		return nil, ErrInvalidMessage
+	}
+
+	c := &CatchUp{
+		Stream: stream.Stream(s),
+	}
+
+	if err := c.Subject.UnmarshalText(subj); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	return c, nil
+}
+
+func Parse(payload []byte) (Message, error) {
+	if len(payload) < headerSize || !bytes.Equal(payload[:len(magic)], []byte(magic)) {
+		return nil, ErrInvalidMessage
+	}
+
+	if payload[len(magic)] != version {
+		return nil, ErrUnknownVersion
+	}
+
+	body := payload[headerSize:]
+
+	switch Type(payload[len(magic)+1]) {
+	case TypeAnnouncement:
+		return parseAnnouncement(body)
+	case TypeCatchUp:
+		return parseCatchUp(body)
+	default:
+		return nil, ErrUnknownType
+	}
+}
@@ -0,0 +1,94 @@
+package control
+
+import (
+	"errors"
+	"testing"
+
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+func TestAnnouncement(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16:20000-20015")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	a := &Announcement{
+		Node:        0x0102030405060708,
+		Fingerprint: pool.Fingerprint(),
+		Pool:        pool.String(),
+	}
+
+	b, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	m, err := Parse(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	parsed, ok := m.(*Announcement)
+	if !ok {
+		t.Fatalf("expected *Announcement, got %T", m)
+	}
+
+	if *parsed != *a {
+		t.Errorf("expected %+v, got %+v", a, parsed)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		input []byte
+		err   error
+	}{
+		{[]byte{}, ErrInvalidMessage},
+		{[]byte("RKTX\x01\x01"), ErrInvalidMessage},
+		{[]byte("RKTC\x02\x01"), ErrUnknownVersion},
+		{[]byte("RKTC\x01\xff"), ErrUnknownType},
+		{[]byte("RKTC\x01\x01short"), ErrInvalidMessage},
+	}
+
+	for _, test := range tests {
+		if _, err := Parse(test.input); !errors.Is(err, test.err) {
+			t.Errorf("expected %v for %q, got %v", test.err, test.input, err)
+		}
+	}
+}
+
+func TestCatchUp(t *testing.T) {
+	su, _ := subject.Parse("org.foo.*")
+
+	c := &CatchUp{
+		Stream:  "stream-1",
+		Subject: su,
+	}
+
+	b, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	m, err := Parse(b)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	parsed, ok := m.(*CatchUp)
+	if !ok {
+		t.Fatalf("expected *CatchUp, got %T", m)
+	}
+
+	if parsed.Stream != c.Stream || parsed.Subject.String() != c.Subject.String() {
+		t.Errorf("expected %+v, got %+v", c, parsed)
+	}
+
+	for _, body := range []string{"stream-1", "\x00org", "stream-1\x00"} {
+		if _, err := Parse(append(header(TypeCatchUp), body...)); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("expected %v for %q, got %v", ErrInvalidMessage, body, err)
+		}
+	}
+}
@@ -1,5 +1,15 @@
 package global
 
+import "time"
+
 const (
 	DefaultPort = 19090
+
+	// Control messages are exchanged on a well-known group that is
+	// independent of the multicast pool configuration.
+	ControlGroup  = "239.255.82.75"
+	ControlGroup6 = "ff14::8275"
+	ControlPort   = 19089
+
+	AnnounceInterval = 5 * time.Second
 )
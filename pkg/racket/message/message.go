@@ -7,13 +7,15 @@ import (
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"log/slog"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
+	"github.com/holoplot/go-racket/pkg/racket/clock"
 	"github.com/holoplot/go-racket/pkg/racket/stream"
 	"github.com/holoplot/go-racket/pkg/racket/subject"
-	"golang.org/x/net/ipv4"
 )
 
 var (
@@ -23,6 +25,30 @@ var (
 	ErrInvalidMessageSize   = fmt.Errorf("invalid message size")
 )
 
+// PacketWriter is implemented by net.PacketConn and multicast.PacketConn.
+type PacketWriter interface {
+	WriteTo(b []byte, addr net.Addr) (int, error)
+}
+
+// Origin identifies one transmission of a message. All copies of a
+// transmission, on any interface or network, carry the same origin, which
+// lets receivers drop the copies that arrive on redundant paths. Publishers
+// number the transmissions of each stream on their own.
+type Origin struct {
+	Publisher uint64
+	Sequence  uint64
+}
+
+// Flags in the most significant bits of the timestamp, which are never set
+// in the timestamp itself
+const (
+	// An origin follows the timestamp
+	originFlag = 0x80
+
+	// The message is a tombstone
+	tombstoneFlag = 0x40
+)
+
 type Message struct {
 	mutex sync.Mutex
 
@@ -32,6 +58,13 @@ type Message struct {
 	Interval  time.Duration
 	hash      string
 	timestamp []byte
+
+	// Origin is set by Parse if the sender included one.
+	Origin Origin
+
+	// Tombstone marks the message as the last of its subject, which the
+	// publisher has deleted.
+	Tombstone bool
 }
 
 func (m *Message) Validate() error {
@@ -46,8 +79,8 @@ func (m *Message) Validate() error {
 	return nil
 }
 
-func makeTimestamp() []byte {
-	t := time.Now().UnixMicro()
+func makeTimestamp(now time.Time) []byte {
+	t := now.UnixMicro()
 	b := bytes.NewBuffer(nil)
 
 	if err := binary.Write(b, binary.BigEndian, t); err != nil {
@@ -62,9 +95,24 @@ func Parse(payload []byte) (*Message, error) {
 		return nil, ErrInvalidMessageSize
 	}
 
-	timestamp := payload[:8]
+	timestamp := slices.Clone(payload[:8])
 	payload = payload[8:]
 
+	flags := timestamp[0] & (originFlag | tombstoneFlag)
+	timestamp[0] &^= flags
+
+	var origin Origin
+
+	if flags&originFlag != 0 {
+		if len(payload) < 16 {
+			return nil, ErrInvalidMessageSize
+		}
+
+		origin.Publisher = binary.BigEndian.Uint64(payload[0:8])
+		origin.Sequence = binary.BigEndian.Uint64(payload[8:16])
+		payload = payload[16:]
+	}
+
 	parts := bytes.SplitN(payload, []byte("\\0"), 3)
 	if len(parts) != 3 {
 		return nil, ErrInvalidMessageFormat
@@ -89,6 +137,8 @@ func Parse(payload []byte) (*Message, error) {
 		Data:      data,
 		Interval:  time.Second,
 		timestamp: timestamp,
+		Origin:    origin,
+		Tombstone: flags&tombstoneFlag != 0,
 	}, nil
 }
 
@@ -105,17 +155,29 @@ func (m *Message) Hash() string {
 	h.Write([]byte(m.Subject.String()))
 	h.Write(m.Data)
 
+	if m.Tombstone {
+		h.Write([]byte{tombstoneFlag})
+	}
+
 	m.hash = hex.EncodeToString(h.Sum(nil))
 
 	return m.hash
 }
 
-func (m *Message) TimeStamp() time.Time {
+// Stamp sets the timestamp of the message to now, unless it already has one.
+// Messages that are sent without being stamped get the current time of the
+// system clock.
+func (m *Message) Stamp(now time.Time) {
 	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	if len(m.timestamp) == 0 {
-		m.timestamp = makeTimestamp()
+		m.timestamp = makeTimestamp(now)
 	}
-	m.mutex.Unlock()
+}
+
+func (m *Message) TimeStamp() time.Time {
+	m.Stamp(clock.Real.Now())
 
 	var t int64
 	if err := binary.Read(bytes.NewReader(m.timestamp), binary.BigEndian, &t); err != nil {
@@ -125,45 +187,80 @@ func (m *Message) TimeStamp() time.Time {
 	return time.UnixMicro(t)
 }
 
-func (m *Message) Send(conn *ipv4.PacketConn, addr net.Addr) error {
-	m.mutex.Lock()
-	if len(m.timestamp) == 0 {
-		m.timestamp = makeTimestamp()
+// MarshalBinary returns the wire representation of the message. Messages
+// that have not been stamped yet are stamped with the system clock, so
+// callers with a clock of their own call Stamp first.
+func (m *Message) MarshalBinary() ([]byte, error) {
+	return m.MarshalBinaryWithOrigin(m.Origin)
+}
+
+// MarshalBinaryWithOrigin is like MarshalBinary, but includes the given
+// origin rather than the message's own. A zero origin is left out.
+func (m *Message) MarshalBinaryWithOrigin(o Origin) ([]byte, error) {
+	m.Stamp(clock.Real.Now())
+
+	timestamp := slices.Clone(m.timestamp)
+
+	if m.Tombstone {
+		timestamp[0] |= tombstoneFlag
+	}
+
+	var origin []byte
+
+	if o != (Origin{}) {
+		timestamp[0] |= originFlag
+
+		origin = binary.BigEndian.AppendUint64(origin, o.Publisher)
+		origin = binary.BigEndian.AppendUint64(origin, o.Sequence)
 	}
-	m.mutex.Unlock()
 
 	p := [][]byte{
-		[]byte(m.timestamp),
+		timestamp,
+		origin,
 		[]byte(m.Stream + "\\0"),
 		[]byte(m.Subject.String() + "\\0"),
 		m.Data,
 	}
 
-	payload := bytes.Join(p, []byte{})
+	return bytes.Join(p, []byte{}), nil
+}
+
+func (m *Message) Send(conn PacketWriter, addr net.Addr) error {
+	payload, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
 
-	if _, err := conn.WriteTo(payload, nil, addr); err != nil {
+	if _, err := conn.WriteTo(payload, addr); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m *Message) PeriodicSend(ctx context.Context, conn *ipv4.PacketConn, addr net.Addr) {
-	ticker := time.NewTicker(m.Interval)
+// PeriodicSend sends the message immediately and then once per interval
+// of c until ctx is done. The message is stamped with c unless it has been
+// stamped already. Failures are reported to logger.
+func (m *Message) PeriodicSend(ctx context.Context, conn PacketWriter, addr net.Addr, c clock.Clock, logger *slog.Logger) {
+	m.Stamp(c.Now())
+
+	ticker := c.NewTicker(m.Interval)
 	defer ticker.Stop()
 
+	logger = logger.With("stream", m.Stream, "subject", m.Subject, "group", addr)
+
 	// Send the message immediately
 	if err := m.Send(conn, addr); err != nil {
-		fmt.Printf("Error sending message: %v\n", err)
+		logger.Error("failed to send message", "error", err)
 	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			if err := m.Send(conn, addr); err != nil {
-				fmt.Printf("Error sending message: %v\n", err)
+				logger.Error("failed to send message", "error", err)
 			}
 		}
 	}
@@ -0,0 +1,124 @@
+package multicastpool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+
+	"github.com/holoplot/go-racket/pkg/racket/global"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+)
+
+var (
+	ErrReservedRange = errors.New("pool overlaps reserved range")
+)
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return n
+}
+
+// Ranges that are reserved for protocol use and must not carry streams.
+var reservedRanges = []*net.IPNet{
+	mustParseCIDR("224.0.0.0/24"),                // Local network control block
+	mustParseCIDR("224.0.1.0/24"),                // Internetwork control block
+	mustParseCIDR(global.ControlGroup + "/32"),   // Racket control group
+	mustParseCIDR(global.ControlGroup6 + "/128"), // Racket control group
+	mustParseCIDR("ff00::/16"),                   // Reserved scope
+	mustParseCIDR("ff01::/16"),                   // Interface-local scope
+	mustParseCIDR("ff02::/16"),                   // Link-local scope, used by NDP and MLD
+	mustParseCIDR("ff0f::/16"),                   // Reserved scope
+}
+
+func overlaps(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Validate checks the pool for overlaps with reserved ranges. Streams mapped
+// into such ranges may interfere with network control protocols. New and
+// Parse do not call it, as they also serve tools that inspect such pools.
+func (m *Pool) Validate() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	var overlapping []string
+
+	for _, r := range reservedRanges {
+		if overlaps(&m.base, r) {
+			overlapping = append(overlapping, r.String())
+		}
+	}
+
+	if len(overlapping) > 0 {
+		return fmt.Errorf("%w: %s overlaps %s", ErrReservedRange, m.base.String(), strings.Join(overlapping, ", "))
+	}
+
+	return nil
+}
+
+// Collision describes a group that is shared by several streams. All
+// receivers of any of these streams receive the traffic of all of them.
+type Collision struct {
+	Group   net.IP          `json:"group"`
+	Streams []stream.Stream `json:"streams"`
+}
+
+// Collisions maps the given streams and returns the groups that are shared
+// by more than one of them, ordered by group.
+func (m *Pool) Collisions(streams []stream.Stream) []Collision {
+	groups := make(map[string]*Collision)
+
+	for _, s := range streams {
+		addr := m.AddressForStream(s)
+		k := addr.IP.String()
+
+		c, ok := groups[k]
+		if !ok {
+			c = &Collision{
+				Group: addr.IP,
+			}
+
+			groups[k] = c
+		}
+
+		if !slices.Contains(c.Streams, s) {
+			c.Streams = append(c.Streams, s)
+		}
+	}
+
+	collisions := make([]Collision, 0)
+
+	for _, c := range groups {
+		if len(c.Streams) > 1 {
+			slices.Sort(c.Streams)
+			collisions = append(collisions, *c)
+		}
+	}
+
+	slices.SortFunc(collisions, func(a, b Collision) int {
+		return slices.Compare(a.Group.To16(), b.Group.To16())
+	})
+
+	return collisions
+}
+
+// StreamsForGroup returns those of the given streams that are mapped to group.
+func (m *Pool) StreamsForGroup(group net.IP, streams []stream.Stream) []stream.Stream {
+	matches := make([]stream.Stream, 0)
+
+	for _, s := range streams {
+		if m.AddressForStream(s).IP.Equal(group) && !slices.Contains(matches, s) {
+			matches = append(matches, s)
+		}
+	}
+
+	slices.Sort(matches)
+
+	return matches
+}
@@ -0,0 +1,118 @@
+package multicastpool
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+)
+
+func TestPool_Validate(t *testing.T) {
+	tests := []struct {
+		pool        string
+		expectError bool
+	}{
+		{"239.0.0.0/16", false},
+		{"239.255.0.0/16", true},
+		{"224.0.0.0/24", true},
+		{"224.0.0.0/16", true},
+		{"224.0.1.0/24", true},
+		{"224.0.2.0/24", false},
+		{"224.0.0.0/4", true},
+		{"ff15::/16", false},
+		{"ff02::/16", true},
+		{"ff14::/16", true},
+	}
+
+	for _, test := range tests {
+		pool, err := Parse(test.pool)
+		if err != nil {
+			t.Fatalf("failed to create pool %s: %v", test.pool, err)
+		}
+
+		err = pool.Validate()
+		if test.expectError != (err != nil) {
+			t.Errorf("unexpected result for pool %s: %v", test.pool, err)
+		}
+
+		if err != nil && !errors.Is(err, ErrReservedRange) {
+			t.Errorf("expected ErrReservedRange for pool %s, got %v", test.pool, err)
+		}
+	}
+}
+
+func TestPool_Collisions(t *testing.T) {
+	// A /28 has 16 groups, so 64 streams must collide.
+	pool, err := Parse("239.1.0.0/28")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	streams := make([]stream.Stream, 0)
+	for i := range 64 {
+		streams = append(streams, stream.Stream(fmt.Sprintf("stream-%d", i)))
+	}
+
+	collisions := pool.Collisions(streams)
+	if len(collisions) == 0 {
+		t.Fatal("expected collisions, got none")
+	}
+
+	total := 0
+
+	for _, c := range collisions {
+		if len(c.Streams) < 2 {
+			t.Errorf("collision on %s with fewer than 2 streams", c.Group)
+		}
+
+		for _, s := range c.Streams {
+			if got := pool.AddressForStream(s).IP; !got.Equal(c.Group) {
+				t.Errorf("stream %s is mapped to %s, not %s", s, got, c.Group)
+			}
+		}
+
+		if got := pool.StreamsForGroup(c.Group, streams); len(got) != len(c.Streams) {
+			t.Errorf("expected %d streams for group %s, got %d", len(c.Streams), c.Group, len(got))
+		}
+
+		total += len(c.Streams)
+	}
+
+	if total > len(streams) {
+		t.Errorf("streams reported in more than one collision")
+	}
+
+	// Separating two colliding streams through an override resolves the collision.
+	a, b := collisions[0].Streams[0], collisions[0].Streams[1]
+	if err := pool.SetOverride(b, &net.UDPAddr{IP: net.ParseIP("239.1.0.15")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if pool.AddressForStream(a).IP.Equal(pool.AddressForStream(b).IP) {
+		t.Error("expected override to separate streams")
+	}
+}
+
+func TestPool_StreamsForGroup(t *testing.T) {
+	pool, err := Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	streams := []stream.Stream{"stream-1", "stream-2"}
+
+	got := pool.StreamsForGroup(net.ParseIP("239.1.137.50"), streams)
+	if len(got) != 1 || got[0] != "stream-1" {
+		t.Errorf("expected [stream-1], got %v", got)
+	}
+
+	if got := pool.StreamsForGroup(net.ParseIP("239.1.0.0"), streams); len(got) != 0 {
+		t.Errorf("expected no streams, got %v", got)
+	}
+
+	if got := pool.Collisions(streams); len(got) != 0 {
+		t.Errorf("expected no collisions, got %v", got)
+	}
+}
@@ -2,45 +2,416 @@ package multicastpool
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/holoplot/go-racket/pkg/racket/global"
 	"github.com/holoplot/go-racket/pkg/racket/stream"
 )
 
 var (
-	ErrInvalidAddress = errors.New("invalid address")
+	ErrInvalidAddress   = errors.New("invalid address")
+	ErrInvalidNetwork   = errors.New("network exceeds the multicast range")
+	ErrInvalidPortRange = errors.New("invalid port range")
+	ErrOutsidePool      = errors.New("override outside of pool")
 )
 
+type Opt interface {
+	apply(*Pool)
+}
+
+type OptPortRange struct {
+	first, last int
+}
+
+// PortRange makes the pool map streams onto the ports first to last
+// (inclusive) in addition to the multicast groups.
+func PortRange(first, last int) Opt {
+	return &OptPortRange{
+		first: first,
+		last:  last,
+	}
+}
+
+func (o *OptPortRange) apply(p *Pool) {
+	p.firstPort = o.first
+	p.lastPort = o.last
+}
+
 type Pool struct {
-	base net.IPNet
+	mutex sync.RWMutex
+
+	base      net.IPNet
+	firstPort int
+	lastPort  int
+	overrides map[stream.Stream]*net.UDPAddr
 }
 
-func New(base net.IPNet) (*Pool, error) {
+// New creates a pool on the multicast network base. Networks that overlap
+// reserved ranges are accepted, so callers that want to rule them out must
+// call Validate themselves.
+func New(base net.IPNet, opts ...Opt) (*Pool, error) {
 	if !base.IP.IsMulticast() {
 		return nil, ErrInvalidAddress
 	}
 
-	return &Pool{
-		base: base,
-	}, nil
+	// The network must not reach beyond 224.0.0.0/4 or ff00::/8.
+	ones, bits := base.Mask.Size()
+	if bits == 0 || (bits == 8*net.IPv4len && ones < 4) || (bits == 8*net.IPv6len && ones < 8) {
+		return nil, ErrInvalidNetwork
+	}
+
+	p := &Pool{
+		base:      base,
+		firstPort: global.DefaultPort,
+		lastPort:  global.DefaultPort,
+		overrides: make(map[stream.Stream]*net.UDPAddr),
+	}
+
+	for _, opt := range opts {
+		opt.apply(p)
+	}
+
+	if p.firstPort <= 0 || p.lastPort > 65535 || p.firstPort > p.lastPort {
+		return nil, ErrInvalidPortRange
+	}
+
+	return p, nil
+}
+
+// Parse creates a pool from its textual representation, a multicast
+// network in CIDR notation, optionally followed by a port or a port
+// range, such as "239.0.0.0/16" or "239.0.0.0/16:19090-19099". Like New, it
+// does not check for reserved ranges.
+func Parse(s string) (*Pool, error) {
+	cidr, ports := s, ""
+
+	if slash := strings.LastIndexByte(s, '/'); slash >= 0 {
+		if colon := strings.IndexByte(s[slash:], ':'); colon >= 0 {
+			cidr, ports = s[:slash+colon], s[slash+colon+1:]
+		}
+	}
+
+	_, base, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	if ports == "" {
+		return New(*base)
+	}
+
+	first, last, err := parsePortRange(ports)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(*base, PortRange(first, last))
+}
+
+func parsePortRange(s string) (int, int, error) {
+	firstStr, lastStr, isRange := strings.Cut(s, "-")
+	if !isRange {
+		lastStr = firstStr
+	}
+
+	first, err := strconv.ParseUint(firstStr, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", ErrInvalidPortRange, s)
+	}
+
+	last, err := strconv.ParseUint(lastStr, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s", ErrInvalidPortRange, s)
+	}
+
+	return int(first), int(last), nil
 }
 
 func (m *Pool) AddressForStream(stream stream.Stream) *net.UDPAddr {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
 	h := sha256.Sum256([]byte(stream))
 
-	ip := make([]byte, 4)
-	copy(ip, m.base.IP.To4())
+	ip := slices.Clone(m.base.IP.To4())
+	if ip == nil || len(m.base.Mask) == net.IPv6len {
+		ip = slices.Clone(m.base.IP.To16())
+	}
 
 	for i, mb := range m.base.Mask {
 		ip[i] |= h[i] & ^mb
 	}
 
+	// The group is derived from the leading bytes of the hash, so use
+	// a disjoint part of it for the port.
+	ports := uint32(m.lastPort - m.firstPort + 1)
+	port := m.firstPort + int(binary.BigEndian.Uint32(h[16:20])%ports)
+
+	if o, ok := m.overrides[stream]; ok {
+		ip = o.IP
+
+		if o.Port != 0 {
+			port = o.Port
+		}
+	}
+
 	udpAddr := &net.UDPAddr{
 		IP:   ip,
-		Port: global.DefaultPort,
+		Port: port,
 	}
 
 	return udpAddr
 }
+
+func (m *Pool) validateOverride(s stream.Stream, addr *net.UDPAddr) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	if !m.base.Contains(addr.IP) {
+		return fmt.Errorf("%w: %s is not in %s", ErrOutsidePool, addr.IP, m.base.String())
+	}
+
+	if addr.Port != 0 && (addr.Port < m.firstPort || addr.Port > m.lastPort) {
+		return fmt.Errorf("%w: port %d is not in %d-%d", ErrOutsidePool, addr.Port, m.firstPort, m.lastPort)
+	}
+
+	return nil
+}
+
+// SetOverride pins a stream to a given group, bypassing the hash mapping.
+// If the port of addr is 0, the port is still derived from the stream name.
+// Overrides must be set before the stream is used by senders or receivers.
+func (m *Pool) SetOverride(s stream.Stream, addr *net.UDPAddr) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := m.validateOverride(s, addr); err != nil {
+		return fmt.Errorf("stream %s: %w", s, err)
+	}
+
+	m.overrides[s] = &net.UDPAddr{
+		IP:   addr.IP,
+		Port: addr.Port,
+	}
+
+	return nil
+}
+
+func (m *Pool) RemoveOverride(s stream.Stream) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	delete(m.overrides, s)
+}
+
+func (m *Pool) Overrides() map[stream.Stream]*net.UDPAddr {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	overrides := make(map[stream.Stream]*net.UDPAddr, len(m.overrides))
+
+	for s, addr := range m.overrides {
+		overrides[s] = &net.UDPAddr{
+			IP:   addr.IP,
+			Port: addr.Port,
+		}
+	}
+
+	return overrides
+}
+
+func parseOverrideAddress(s string) (*net.UDPAddr, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		return &net.UDPAddr{IP: ip}, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(s)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, s)
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidAddress, s)
+	}
+
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// LoadOverrides replaces all overrides with the ones read from r. The input
+// is a JSON object that maps stream names to a group, optionally with a port:
+//
+//	{"stream-1": "239.0.4.2", "stream-2": "239.0.4.3:19091"}
+func (m *Pool) LoadOverrides(r io.Reader) error {
+	var raw map[stream.Stream]string
+
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return fmt.Errorf("failed to decode overrides: %w", err)
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	overrides := make(map[stream.Stream]*net.UDPAddr, len(raw))
+
+	for s, str := range raw {
+		addr, err := parseOverrideAddress(str)
+		if err != nil {
+			return fmt.Errorf("stream %s: %w", s, err)
+		}
+
+		if err := m.validateOverride(s, addr); err != nil {
+			return fmt.Errorf("stream %s: %w", s, err)
+		}
+
+		overrides[s] = addr
+	}
+
+	m.overrides = overrides
+
+	return nil
+}
+
+func (m *Pool) LoadOverridesFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	return m.LoadOverrides(f)
+}
+
+// Fingerprint is a digest of a pool's configuration, including overrides.
+// Nodes that disagree on the fingerprint map streams differently.
+type Fingerprint [sha256.Size]byte
+
+func (f Fingerprint) String() string {
+	return hex.EncodeToString(f[:8])
+}
+
+func (f Fingerprint) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(f[:])), nil
+}
+
+func (m *Pool) Fingerprint() Fingerprint {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00", m.base.String(), m.firstPort, m.lastPort)
+
+	streams := make([]stream.Stream, 0, len(m.overrides))
+	for s := range m.overrides {
+		streams = append(streams, s)
+	}
+
+	slices.Sort(streams)
+
+	for _, s := range streams {
+		fmt.Fprintf(h, "%s\x00%s\x00", s, m.overrides[s])
+	}
+
+	var f Fingerprint
+	copy(f[:], h.Sum(nil))
+
+	return f
+}
+
+// Network returns "udp4" or "udp6", depending on the family of the pool.
+func (m *Pool) Network() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if len(m.base.Mask) == net.IPv4len {
+		return "udp4"
+	}
+
+	return "udp6"
+}
+
+// ControlAddress returns the address of the well-known control group of
+// the pool's family.
+func (m *Pool) ControlAddress() *net.UDPAddr {
+	group := global.ControlGroup
+	if m.Network() == "udp6" {
+		group = global.ControlGroup6
+	}
+
+	return &net.UDPAddr{
+		IP:   net.ParseIP(group),
+		Port: global.ControlPort,
+	}
+}
+
+// Ports returns the first and last port of the pool's port range.
+func (m *Pool) Ports() (int, int) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return m.firstPort, m.lastPort
+}
+
+func (m *Pool) String() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if m.base.IP == nil {
+		return ""
+	}
+
+	switch {
+	case m.firstPort == global.DefaultPort && m.lastPort == global.DefaultPort:
+		return m.base.String()
+	case m.firstPort == m.lastPort:
+		return fmt.Sprintf("%s:%d", m.base.String(), m.firstPort)
+	default:
+		return fmt.Sprintf("%s:%d-%d", m.base.String(), m.firstPort, m.lastPort)
+	}
+}
+
+func (m *Pool) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Pool) UnmarshalText(text []byte) error {
+	p, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Overrides are not part of the textual representation and may not
+	// fit the new definition, so they are dropped.
+	m.base = p.base
+	m.firstPort = p.firstPort
+	m.lastPort = p.lastPort
+	m.overrides = p.overrides
+
+	return nil
+}
+
+// Set implements flag.Value.
+func (m *Pool) Set(value string) error {
+	return m.UnmarshalText([]byte(value))
+}
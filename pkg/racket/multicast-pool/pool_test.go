@@ -1,7 +1,13 @@
 package multicastpool
 
 import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"net"
+	"strings"
 	"testing"
 
 	"github.com/holoplot/go-racket/pkg/racket/stream"
@@ -36,6 +42,12 @@ func TestPool_AddressForStream(t *testing.T) {
 			stream: stream.Stream("stream-1"),
 			want:   "239.1.137.50",
 		},
+		{
+			name:   "IPv6",
+			base:   "ff15::/16",
+			stream: stream.Stream("stream-1"),
+			want:   "ff15:8932:e3b4:af06:6907:78f2:598:ed04",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -55,3 +67,268 @@ func TestPool_AddressForStream(t *testing.T) {
 		})
 	}
 }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectError bool
+	}{
+		{"239.0.0.0/16", false},
+		{"224.0.0.0/4", false},
+		{"192.168.0.0/16", true},
+		{"224.0.0.0/3", true},
+		{"239.0.0.0/16:19091", false},
+		{"239.0.0.0/16:20000-20015", false},
+		{"239.0.0.0/16:20015-20000", true},
+		{"239.0.0.0/16:0", true},
+		{"239.0.0.0/16:70000", true},
+		{"239.0.0.0/16:foo", true},
+		{"ff15::/16", false},
+		{"ff15::/16:20000-20015", false},
+		{"ff15::/7", true},
+		{"fd00::/16", true},
+		{"239.0.0.0", true},
+		{"", true},
+	}
+
+	for _, test := range tests {
+		pool, err := Parse(test.input)
+		if test.expectError {
+			if err == nil {
+				t.Errorf("expected error for input %q, got nil", test.input)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", test.input, err)
+			continue
+		}
+
+		if pool.String() != test.input {
+			t.Errorf("expected %q, got %q", test.input, pool)
+		}
+	}
+}
+
+func TestPool_AddressForStream_PortRange(t *testing.T) {
+	pool, err := Parse("239.1.0.0/16:20000-20015")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	ports := make(map[int]struct{})
+
+	for i := range 256 {
+		s := stream.Stream(fmt.Sprintf("stream-%d", i))
+		addr := pool.AddressForStream(s)
+
+		if addr.Port < 20000 || addr.Port > 20015 {
+			t.Fatalf("port %d for stream %s out of range", addr.Port, s)
+		}
+
+		if again := pool.AddressForStream(s); !again.IP.Equal(addr.IP) || again.Port != addr.Port {
+			t.Fatalf("address for stream %s is not stable: %v != %v", s, addr, again)
+		}
+
+		ports[addr.Port] = struct{}{}
+	}
+
+	if len(ports) != 16 {
+		t.Errorf("expected streams to be spread over 16 ports, got %d", len(ports))
+	}
+
+	// The group must not depend on the port range.
+	if got := pool.AddressForStream(stream.Stream("stream-1")); got.IP.String() != "239.1.137.50" {
+		t.Errorf("Pool.AddressForStream() = %v, want %v", got.IP, "239.1.137.50")
+	}
+}
+
+func TestNew_PortRange(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to parse CIDR: %v", err)
+	}
+
+	if _, err := New(*ipNet, PortRange(100, 99)); err == nil {
+		t.Error("expected error for inverted port range, got nil")
+	}
+
+	pool, err := New(*ipNet, PortRange(100, 199))
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	if first, last := pool.Ports(); first != 100 || last != 199 {
+		t.Errorf("expected ports 100-199, got %d-%d", first, last)
+	}
+}
+
+func TestPool_SetOverride(t *testing.T) {
+	pool, err := Parse("239.1.0.0/16:20000-20015")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	s := stream.Stream("stream-1")
+	hashed := pool.AddressForStream(s)
+
+	if err := pool.SetOverride(s, &net.UDPAddr{IP: net.ParseIP("239.1.42.42")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := pool.AddressForStream(s)
+	if got.IP.String() != "239.1.42.42" || got.Port != hashed.Port {
+		t.Errorf("expected 239.1.42.42:%d, got %v", hashed.Port, got)
+	}
+
+	if err := pool.SetOverride(s, &net.UDPAddr{IP: net.ParseIP("239.1.42.43"), Port: 20001}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := pool.AddressForStream(s); got.String() != "239.1.42.43:20001" {
+		t.Errorf("expected 239.1.42.43:20001, got %v", got)
+	}
+
+	if err := pool.SetOverride(s, &net.UDPAddr{IP: net.ParseIP("239.2.0.1")}); !errors.Is(err, ErrOutsidePool) {
+		t.Errorf("expected ErrOutsidePool for group outside of pool, got %v", err)
+	}
+
+	if err := pool.SetOverride(s, &net.UDPAddr{IP: net.ParseIP("239.1.0.1"), Port: 19090}); !errors.Is(err, ErrOutsidePool) {
+		t.Errorf("expected ErrOutsidePool for port outside of pool, got %v", err)
+	}
+
+	pool.RemoveOverride(s)
+
+	if got := pool.AddressForStream(s); !got.IP.Equal(hashed.IP) || got.Port != hashed.Port {
+		t.Errorf("expected %v after removing override, got %v", hashed, got)
+	}
+}
+
+func TestPool_LoadOverrides(t *testing.T) {
+	pool, err := Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	config := `{"stream-1": "239.1.0.1", "stream-2": "239.1.0.2:19090"}`
+	if err := pool.LoadOverrides(strings.NewReader(config)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := pool.AddressForStream("stream-1"); got.String() != "239.1.0.1:19090" {
+		t.Errorf("expected 239.1.0.1:19090, got %v", got)
+	}
+
+	if len(pool.Overrides()) != 2 {
+		t.Errorf("expected 2 overrides, got %d", len(pool.Overrides()))
+	}
+
+	for _, config := range []string{
+		`{"stream-1": "10.0.0.1"}`,
+		`{"stream-1": "239.1.0.1:19091"}`,
+		`{"stream-1": "foo"}`,
+		`["stream-1"]`,
+	} {
+		if err := pool.LoadOverrides(strings.NewReader(config)); err == nil {
+			t.Errorf("expected error for %s, got nil", config)
+		}
+	}
+
+	// Failed loads must leave the previous overrides in place.
+	if got := pool.AddressForStream("stream-1"); got.String() != "239.1.0.1:19090" {
+		t.Errorf("expected 239.1.0.1:19090, got %v", got)
+	}
+}
+
+func TestPool_Fingerprint(t *testing.T) {
+	a, err := Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	b, err := Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("expected identical pools to have the same fingerprint")
+	}
+
+	for _, s := range []string{"239.1.0.0/17", "239.1.0.0/16:19091", "239.2.0.0/16"} {
+		c, err := Parse(s)
+		if err != nil {
+			t.Fatalf("failed to create pool: %v", err)
+		}
+
+		if a.Fingerprint() == c.Fingerprint() {
+			t.Errorf("expected pool %s to have a different fingerprint than %s", c, a)
+		}
+	}
+
+	if err := a.LoadOverrides(strings.NewReader(`{"a": "239.1.0.1", "b": "239.1.0.2"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Error("expected overrides to change the fingerprint")
+	}
+
+	if err := b.SetOverride("b", &net.UDPAddr{IP: net.ParseIP("239.1.0.2")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := b.SetOverride("a", &net.UDPAddr{IP: net.ParseIP("239.1.0.1")}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Error("expected identical overrides to result in the same fingerprint")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type config struct {
+		Pool *Pool `json:"pool"`
+	}
+
+	var c config
+	if err := json.Unmarshal([]byte(`{"pool":"239.1.0.0/16"}`), &c); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if c.Pool.String() != "239.1.0.0/16" {
+		t.Errorf("expected %q, got %q", "239.1.0.0/16", c.Pool)
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if string(b) != `{"pool":"239.1.0.0/16"}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+
+	if err := json.Unmarshal([]byte(`{"pool":"10.0.0.0/8"}`), &c); err == nil {
+		t.Error("expected error for non-multicast pool, got nil")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	var pool Pool
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&pool, "pool", "multicast pool")
+
+	if err := fs.Parse([]string{"-pool", "239.1.0.0/16"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := pool.AddressForStream(stream.Stream("stream-1")); got.IP.String() != "239.1.137.50" {
+		t.Errorf("Pool.AddressForStream() = %v, want %v", got, "239.1.137.50")
+	}
+}
@@ -0,0 +1,225 @@
+package racket
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+// Tombstones of deleted subjects are kept for this long if values do not go
+// stale
+const defaultTombstoneTTL = time.Minute
+
+// Entry is the last value of a subject held by the cache.
+type Entry struct {
+	Message *message.Message
+
+	// Updated is when the value last changed, Refreshed when it was last
+	// received.
+	Updated   time.Time
+	Refreshed time.Time
+
+	// Age is the time since the value was last received, as of the query.
+	Age time.Duration
+}
+
+type cacheConfig struct {
+	staleAfter time.Duration
+	streams    []stream.Stream
+}
+
+func (c *cacheConfig) caches(s stream.Stream) bool {
+	return c != nil && (len(c.streams) == 0 || slices.Contains(c.streams, s))
+}
+
+// lastValueCache holds the last value of each subject of a stream.
+type lastValueCache struct {
+	mutex sync.Mutex
+
+	staleAfter time.Duration
+	entries    map[string]*Entry
+
+	// Tombstones of deleted subjects
+	deleted   map[string]tombstone
+	lastSweep time.Time
+}
+
+type tombstone struct {
+	stamp    time.Time
+	received time.Time
+}
+
+func newLastValueCache(staleAfter time.Duration) *lastValueCache {
+	return &lastValueCache{
+		staleAfter: staleAfter,
+		entries:    make(map[string]*Entry),
+		deleted:    make(map[string]tombstone),
+	}
+}
+
+// update stores msg as the value of its subject, unless the cache holds a
+// newer value or tombstone. Copies that are delayed on the network or sent
+// by a resend that raced with an update must not replace the current value
+// or bring back a deleted subject.
+func (c *lastValueCache) update(msg *message.Message, now time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.sweep(now)
+
+	k := msg.Subject.String()
+	ts := msg.TimeStamp()
+
+	if d, ok := c.deleted[k]; ok && ts.Before(d.stamp) {
+		return
+	}
+
+	e, ok := c.entries[k]
+	if ok && ts.Before(e.Message.TimeStamp()) {
+		return
+	}
+
+	if msg.Tombstone {
+		delete(c.entries, k)
+		c.deleted[k] = tombstone{stamp: ts, received: now}
+		return
+	}
+
+	delete(c.deleted, k)
+
+	if ok && e.Message.Hash() == msg.Hash() {
+		e.Message = msg
+		e.Refreshed = now
+		return
+	}
+
+	c.entries[k] = &Entry{
+		Message:   msg,
+		Updated:   now,
+		Refreshed: now,
+	}
+}
+
+func (c *lastValueCache) stale(e *Entry, now time.Time) bool {
+	return c.staleAfter > 0 && now.Sub(e.Refreshed) > c.staleAfter
+}
+
+// tombstoneTTL returns how long tombstones are kept. Like values, they
+// expire once they are stale.
+func (c *lastValueCache) tombstoneTTL() time.Duration {
+	if c.staleAfter > 0 {
+		return c.staleAfter
+	}
+
+	return defaultTombstoneTTL
+}
+
+// sweep drops stale values and expired tombstones once per tombstone TTL,
+// so that subjects that are no longer sent do not pile up. The lock must be
+// held.
+func (c *lastValueCache) sweep(now time.Time) {
+	ttl := c.tombstoneTTL()
+
+	if now.Sub(c.lastSweep) < ttl {
+		return
+	}
+
+	c.lastSweep = now
+
+	for k, e := range c.entries {
+		if c.stale(e, now) {
+			delete(c.entries, k)
+		}
+	}
+
+	for k, d := range c.deleted {
+		if now.Sub(d.received) > ttl {
+			delete(c.deleted, k)
+		}
+	}
+}
+
+// entry returns a copy of the entry of subject k, and drops it if it has
+// gone stale. The lock must be held.
+func (c *lastValueCache) entry(k string, now time.Time) (Entry, bool) {
+	e, ok := c.entries[k]
+	if !ok {
+		return Entry{}, false
+	}
+
+	if c.stale(e, now) {
+		delete(c.entries, k)
+		return Entry{}, false
+	}
+
+	entry := *e
+	entry.Age = now.Sub(e.Refreshed)
+
+	return entry, true
+}
+
+func (c *lastValueCache) get(s subject.Subject, now time.Time) (Entry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.entry(s.String(), now)
+}
+
+func (c *lastValueCache) list(pattern subject.Subject, now time.Time) []Entry {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var entries []Entry
+
+	for k, e := range c.entries {
+		if !pattern.Matches(e.Message.Subject) {
+			continue
+		}
+
+		if entry, ok := c.entry(k, now); ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return strings.Compare(a.Message.Subject.String(), b.Message.Subject.String())
+	})
+
+	return entries
+}
+
+// Get returns the last value of subject in stream. It reports false if
+// there is none, the subject was deleted or has gone stale, or the stream
+// is not cached. Streams are only cached while they are subscribed to.
+func (r *Receiver) Get(stream stream.Stream, subject subject.Subject) (Entry, bool) {
+	c := r.cache(stream)
+	if c == nil {
+		return Entry{}, false
+	}
+
+	return c.get(subject, r.clock.Now())
+}
+
+// List returns the last values of all subjects in stream that match
+// pattern, sorted by subject. Patterns match like the subjects of
+// subscriptions.
+func (r *Receiver) List(stream stream.Stream, pattern subject.Subject) []Entry {
+	c := r.cache(stream)
+	if c == nil {
+		return nil
+	}
+
+	return c.list(pattern, r.clock.Now())
+}
+
+func (r *Receiver) cache(s stream.Stream) *lastValueCache {
+	r.cachesMutex.Lock()
+	defer r.cachesMutex.Unlock()
+
+	return r.caches[s]
+}
@@ -0,0 +1,314 @@
+package racket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	sender "github.com/holoplot/go-racket/pkg/racket/sender"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/subscription"
+	"github.com/holoplot/go-racket/pkg/racket/transport/memory"
+)
+
+func newTestCache(t *testing.T, opts ...Opt) (*sender.Sender, *Receiver, *clock.Fake) {
+	t.Helper()
+
+	pool := newTestPool(t, "239.1.0.0/16")
+	bus := memory.NewBus()
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	s, err := sender.NewWithTransport(bus.NewTransport(), pool, sender.Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	r, err := NewWithTransport(bus.NewTransport(), pool, append(opts, Clock(c))...)
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+		r.Close()
+	})
+
+	su, _ := subject.Parse("*")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	return s, r, c
+}
+
+func publish(t *testing.T, s *sender.Sender, subj, data string) *message.Message {
+	t.Helper()
+
+	su, _ := subject.Parse(subj)
+	m := &message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Data:     []byte(data),
+		Interval: time.Hour,
+	}
+
+	if err := s.Publish(m); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	return m
+}
+
+func TestReceiver_Get(t *testing.T) {
+	s, r, c := newTestCache(t, LastValueCache(0))
+
+	su, _ := subject.Parse("org.foo")
+
+	if _, ok := r.Get("stream-1", su); ok {
+		t.Fatal("expected no value before publishing")
+	}
+
+	publish(t, s, "org.foo", "1")
+	c.Advance(time.Second)
+	m := publish(t, s, "org.foo", "2")
+	c.Advance(time.Second)
+
+	e, ok := r.Get("stream-1", su)
+	if !ok {
+		t.Fatal("expected a value")
+	}
+
+	if string(e.Message.Data) != "2" || e.Age != time.Second {
+		t.Errorf("unexpected entry %q, age %s", e.Message.Data, e.Age)
+	}
+
+	if err := s.Delete(m); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	if _, ok := r.Get("stream-1", su); ok {
+		t.Error("expected no value after the tombstone")
+	}
+
+	if _, ok := r.Get("stream-2", su); ok {
+		t.Error("expected no value for a stream not subscribed to")
+	}
+}
+
+func TestReceiver_List(t *testing.T) {
+	s, r, _ := newTestCache(t, LastValueCache(0))
+
+	for _, subj := range []string{"org.foo.b", "org.foo.a", "org.bar"} {
+		publish(t, s, subj, subj)
+	}
+
+	pattern, _ := subject.Parse("org.foo.*")
+
+	var got []string
+	for _, e := range r.List("stream-1", pattern) {
+		got = append(got, e.Message.Subject.String())
+	}
+
+	if len(got) != 2 || got[0] != "org.foo.a" || got[1] != "org.foo.b" {
+		t.Errorf("unexpected subjects %v", got)
+	}
+}
+
+func TestReceiver_CacheStale(t *testing.T) {
+	s, r, c := newTestCache(t, LastValueCache(time.Minute))
+
+	publish(t, s, "org.foo", "1")
+	c.Advance(time.Minute)
+
+	pattern, _ := subject.Parse("*")
+	if n := len(r.List("stream-1", pattern)); n != 1 {
+		t.Fatalf("expected a fresh value, got %d", n)
+	}
+
+	c.Advance(time.Second)
+
+	if n := len(r.List("stream-1", pattern)); n != 0 {
+		t.Errorf("expected the value to be stale, got %d", n)
+	}
+}
+
+func TestReceiver_CacheStreams(t *testing.T) {
+	s, r, _ := newTestCache(t, LastValueCache(0, "stream-2"))
+
+	publish(t, s, "org.foo", "1")
+
+	su, _ := subject.Parse("org.foo")
+	if _, ok := r.Get("stream-1", su); ok {
+		t.Error("expected stream-1 not to be cached")
+	}
+}
+
+func TestReceiver_Replay(t *testing.T) {
+	s, r, _ := newTestCache(t, LastValueCache(0))
+
+	publish(t, s, "org.foo", "1")
+	publish(t, s, "org.bar", "2")
+
+	var got []string
+
+	su, _ := subject.Parse("org.foo")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		got = append(got, string(msg.Data))
+	}, subscription.Replay()); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if len(got) != 1 || got[0] != "1" {
+		t.Fatalf("expected the cached value, got %v", got)
+	}
+
+	publish(t, s, "org.foo", "3")
+
+	if len(got) != 2 || got[1] != "3" {
+		t.Errorf("expected live updates after the replay, got %v", got)
+	}
+}
+
+// TestReceiver_GetFromCallback checks that callbacks can query the cache
+// while a subscription to the same stream is being added.
+func TestReceiver_GetFromCallback(t *testing.T) {
+	s, r, _ := newTestCache(t, LastValueCache(0))
+
+	entered := make(chan struct{}, 16)
+	proceed := make(chan struct{})
+	queried := make(chan bool, 16)
+
+	su, _ := subject.Parse("org.foo")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		entered <- struct{}{}
+		<-proceed
+
+		_, ok := r.Get("stream-1", msg.Subject)
+		queried <- ok
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	// The memory transport dispatches while publishing.
+	go s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Data:     []byte("1"),
+		Interval: time.Hour,
+	})
+
+	<-entered
+
+	// The subscription waits for the dispatch to finish.
+	subscribed := make(chan error, 1)
+
+	go func() {
+		other, _ := subject.Parse("org.bar")
+		_, err := r.Subscribe("stream-1", other, func(*message.Message) {})
+		subscribed <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	close(proceed)
+
+	select {
+	case ok := <-queried:
+		if !ok {
+			t.Error("expected a value")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("callback blocked on the cache")
+	}
+
+	if err := <-subscribed; err != nil {
+		t.Errorf("failed to subscribe: %v", err)
+	}
+}
+
+func TestLastValueCache_Order(t *testing.T) {
+	c := newLastValueCache(0)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	su, _ := subject.Parse("org.foo")
+
+	msg := func(data string, at time.Duration, tombstone bool) *message.Message {
+		m := &message.Message{Stream: "stream-1", Subject: su, Data: []byte(data), Tombstone: tombstone}
+		m.Stamp(now.Add(at))
+
+		return m
+	}
+
+	value := func() string {
+		e, ok := c.get(su, now)
+		if !ok {
+			return ""
+		}
+
+		return string(e.Message.Data)
+	}
+
+	for _, step := range []struct {
+		what     string
+		msg      *message.Message
+		expected string
+	}{
+		{"first value", msg("1", 0, false), "1"},
+		{"newer value", msg("2", 2*time.Second, false), "2"},
+		{"late copy of an older value", msg("1", 0, false), "2"},
+		{"late tombstone", msg("", time.Second, true), "2"},
+		{"tombstone", msg("", 3*time.Second, true), ""},
+		{"late copy of the deleted value", msg("2", 2*time.Second, false), ""},
+		{"value after the tombstone", msg("3", 4*time.Second, false), "3"},
+	} {
+		c.update(step.msg, now)
+
+		if got := value(); got != step.expected {
+			t.Errorf("%s: expected %q, got %q", step.what, step.expected, got)
+		}
+	}
+}
+
+func TestLastValueCache_Sweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	msg := func(s string, tombstone bool) *message.Message {
+		su, _ := subject.Parse(s)
+		m := &message.Message{Stream: "stream-1", Subject: su, Tombstone: tombstone}
+		m.Stamp(now)
+
+		return m
+	}
+
+	for _, tt := range []struct {
+		name       string
+		staleAfter time.Duration
+		after      time.Duration
+	}{
+		{"default", 0, defaultTombstoneTTL},
+		{"stale after", 10 * time.Second, 10 * time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLastValueCache(tt.staleAfter)
+
+			c.update(msg("org.foo", false), now)
+			c.update(msg("org.bar", true), now)
+
+			// Subjects that are no longer sent are dropped with the next
+			// update of any other subject.
+			c.update(msg("org.baz", false), now.Add(tt.after+time.Second))
+
+			if _, ok := c.deleted["org.bar"]; ok {
+				t.Error("expected the tombstone to expire")
+			}
+
+			_, ok := c.entries["org.foo"]
+			if stale := tt.staleAfter > 0; ok == stale {
+				t.Errorf("expected the value to be dropped: %v, got %v", stale, !ok)
+			}
+
+			if _, ok := c.entries["org.baz"]; !ok {
+				t.Error("expected the new value to be cached")
+			}
+		})
+	}
+}
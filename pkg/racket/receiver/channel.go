@@ -0,0 +1,123 @@
+package racket
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/subscription"
+)
+
+// Overflow decides what happens to messages that arrive while the buffer of
+// a channel subscription is full. Dispatching never blocks on a slow
+// consumer.
+type Overflow int
+
+const (
+	// DropOldest makes room by discarding the oldest buffered message.
+	DropOldest Overflow = iota
+
+	// DropNewest discards the arriving message.
+	DropNewest
+)
+
+func (o Overflow) String() string {
+	switch o {
+	case DropOldest:
+		return "drop oldest"
+	case DropNewest:
+		return "drop newest"
+	default:
+		return fmt.Sprintf("unknown (%d)", int(o))
+	}
+}
+
+// SubscribeChan is like Subscribe, but delivers the messages on a channel
+// that buffers up to size of them. When ctx is done, the subscription is
+// removed, and the channel is closed once the buffered messages are read.
+func (r *Receiver) SubscribeChan(ctx context.Context, stream stream.Stream, subject subject.Subject, size int, overflow Overflow, opts ...subscription.Opt) (<-chan *message.Message, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: buffer size %d", ErrInvalidOption, size)
+	}
+
+	if overflow != DropOldest && overflow != DropNewest {
+		return nil, fmt.Errorf("%w: overflow policy %s", ErrInvalidOption, overflow)
+	}
+
+	var (
+		mutex  sync.Mutex
+		closed bool
+	)
+
+	ch := make(chan *message.Message, size)
+
+	sub, err := r.Subscribe(stream, subject, func(msg *message.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if closed {
+			return
+		}
+
+		for {
+			select {
+			case ch <- msg:
+				return
+			default:
+			}
+
+			if overflow == DropNewest {
+				return
+			}
+
+			select {
+			case <-ch:
+			default:
+			}
+		}
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		sub.Close()
+
+		mutex.Lock()
+		closed = true
+		close(ch)
+		mutex.Unlock()
+	}()
+
+	return ch, nil
+}
+
+// SubscribeSeq is like SubscribeChan, but returns the messages as a
+// sequence. The sequence ends once ctx is done and the buffered messages
+// are read, and the subscription is removed when ctx is done or the loop
+// over the sequence ends.
+func (r *Receiver) SubscribeSeq(ctx context.Context, stream stream.Stream, subject subject.Subject, size int, overflow Overflow, opts ...subscription.Opt) (iter.Seq[*message.Message], error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	ch, err := r.SubscribeChan(ctx, stream, subject, size, overflow, opts...)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	return func(yield func(*message.Message) bool) {
+		defer cancel()
+
+		for msg := range ch {
+			if !yield(msg) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,135 @@
+package racket
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+func TestReceiver_SubscribeChan(t *testing.T) {
+	for _, test := range []struct {
+		overflow Overflow
+		want     []string
+	}{
+		{DropOldest, []string{"2", "3"}},
+		{DropNewest, []string{"1", "2"}},
+	} {
+		t.Run(test.overflow.String(), func(t *testing.T) {
+			s, r, _ := newTestCache(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			su, _ := subject.Parse("org.*")
+			ch, err := r.SubscribeChan(ctx, "stream-1", su, 2, test.overflow)
+			if err != nil {
+				t.Fatalf("failed to subscribe: %v", err)
+			}
+
+			for _, v := range []string{"1", "2", "3"} {
+				publish(t, s, "org."+v, v)
+			}
+
+			cancel()
+
+			// The buffered messages are still delivered before the channel
+			// is closed.
+			var got []string
+			for msg := range ch {
+				got = append(got, string(msg.Data))
+			}
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestReceiver_SubscribeChanInvalid(t *testing.T) {
+	_, r, _ := newTestCache(t)
+
+	su, _ := subject.Parse("org.*")
+
+	if _, err := r.SubscribeChan(context.Background(), "stream-1", su, 0, DropOldest); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected invalid option error for size 0, got %v", err)
+	}
+
+	if _, err := r.SubscribeChan(context.Background(), "stream-1", su, 1, Overflow(-1)); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected invalid option error for unknown policy, got %v", err)
+	}
+}
+
+func TestReceiver_SubscribeSeq(t *testing.T) {
+	s, r, _ := newTestCache(t)
+
+	subscriptions := func() int {
+		return r.Stats().Streams["stream-1"].SubscriptionStats.SubscriptionsCount
+	}
+
+	before := subscriptions()
+
+	su, _ := subject.Parse("org.*")
+	seq, err := r.SubscribeSeq(context.Background(), "stream-1", su, 4, DropNewest)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	publish(t, s, "org.foo", "1")
+	publish(t, s, "org.bar", "2")
+
+	var got []string
+	for msg := range seq {
+		got = append(got, string(msg.Data))
+
+		if len(got) == 2 {
+			break
+		}
+	}
+
+	if !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("unexpected messages %v", got)
+	}
+
+	// Leaving the loop removes the subscription.
+	deadline := time.Now().Add(time.Second)
+	for subscriptions() != before {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d subscriptions, got %d", before, subscriptions())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReceiver_SubscribeSeqCancel(t *testing.T) {
+	s, r, _ := newTestCache(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	su, _ := subject.Parse("org.*")
+	seq, err := r.SubscribeSeq(ctx, "stream-1", su, 4, DropNewest)
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	publish(t, s, "org.foo", "1")
+	publish(t, s, "org.bar", "2")
+
+	cancel()
+
+	// The buffered messages are still delivered before the sequence ends.
+	var got []string
+	for msg := range seq {
+		got = append(got, string(msg.Data))
+	}
+
+	if !slices.Equal(got, []string{"1", "2"}) {
+		t.Errorf("unexpected messages %v", got)
+	}
+}
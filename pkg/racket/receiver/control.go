@@ -0,0 +1,198 @@
+package racket
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/control"
+	"github.com/holoplot/go-racket/pkg/racket/global"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+// Peers that have not announced themselves for this long are forgotten.
+const peerTimeout = 3 * global.AnnounceInterval
+
+// PoolMismatch describes a peer that announced a multicast pool
+// configuration that differs from the receiver's own.
+type PoolMismatch struct {
+	Node        uint64                    `json:"node"`
+	Addr        net.Addr                  `json:"addr,omitempty"`
+	Pool        string                    `json:"pool,omitempty"`
+	Fingerprint multicastpool.Fingerprint `json:"fingerprint"`
+}
+
+type peer struct {
+	mismatch PoolMismatch
+	lastSeen time.Time
+}
+
+// OnPoolMismatch registers a callback that is invoked whenever a peer
+// announces a pool configuration that differs from the receiver's own.
+func (r *Receiver) OnPoolMismatch(cb func(PoolMismatch)) {
+	r.peersMutex.Lock()
+	defer r.peersMutex.Unlock()
+
+	r.onPoolMismatch = cb
+}
+
+// joinControl joins the control group of every network the pools are in.
+// It must be called with the receiver's mutex held.
+func (r *Receiver) joinControl() error {
+	if r.control != nil {
+		return nil
+	}
+
+	joined := make(map[string]bool)
+
+	for _, pool := range r.MulticastPools {
+		addr := pool.ControlAddress()
+
+		if joined[addr.String()] {
+			continue
+		}
+
+		m, err := r.transport.Join(addr, r.controlReceive)
+		if err != nil {
+			for _, m := range r.control {
+				m.Close()
+			}
+
+			r.control = nil
+
+			return err
+		}
+
+		r.control = append(r.control, m)
+		joined[addr.String()] = true
+	}
+
+	return nil
+}
+
+// requestCatchUp asks the senders of stream to resend the messages matching
+// pattern right away.
+func (r *Receiver) requestCatchUp(s stream.Stream, pattern subject.Subject) {
+	payload, err := (&control.CatchUp{Stream: s, Subject: pattern}).MarshalBinary()
+	if err != nil {
+		r.logger.Error("failed to marshal catch-up request", "error", err)
+		return
+	}
+
+	sent := make(map[string]bool)
+
+	for _, pool := range r.MulticastPools {
+		addr := pool.ControlAddress()
+
+		if sent[addr.String()] {
+			continue
+		}
+
+		sent[addr.String()] = true
+
+		if err := r.transport.Send(payload, addr); err != nil {
+			r.logger.Warn("failed to send catch-up request",
+				"stream", s, "subject", pattern, "group", addr, "error", err)
+		}
+	}
+}
+
+func (r *Receiver) isOwnFingerprint(f multicastpool.Fingerprint) bool {
+	for _, pool := range r.MulticastPools {
+		if pool.Fingerprint() == f {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r *Receiver) controlReceive(payload []byte, src net.Addr, _ string) {
+	m, err := control.Parse(payload)
+	if err != nil {
+		r.logger.Debug("dropping control message", "source", src, "error", err)
+		return
+	}
+
+	switch m := m.(type) {
+	case *control.Announcement:
+		r.handleAnnouncement(m, src)
+	}
+}
+
+func (r *Receiver) handleAnnouncement(a *control.Announcement, src net.Addr) {
+	now := r.clock.Now()
+
+	r.peersMutex.Lock()
+
+	for node, p := range r.peers {
+		if now.Sub(p.lastSeen) > peerTimeout {
+			delete(r.peers, node)
+		}
+	}
+
+	if r.isOwnFingerprint(a.Fingerprint) {
+		delete(r.peers, a.Node)
+		r.peersMutex.Unlock()
+
+		return
+	}
+
+	p, known := r.peers[a.Node]
+	changed := !known || p.mismatch.Fingerprint != a.Fingerprint
+
+	mismatch := PoolMismatch{
+		Node:        a.Node,
+		Addr:        src,
+		Pool:        a.Pool,
+		Fingerprint: a.Fingerprint,
+	}
+
+	r.peers[a.Node] = &peer{
+		mismatch: mismatch,
+		lastSeen: now,
+	}
+
+	cb := r.onPoolMismatch
+
+	r.peersMutex.Unlock()
+
+	if changed {
+		r.logger.Warn("peer uses a different pool configuration",
+			"node", fmt.Sprintf("%x", a.Node), "source", src, "pool", a.Pool, "fingerprint", a.Fingerprint)
+	}
+
+	if changed && cb != nil {
+		cb(mismatch)
+	}
+}
+
+func (r *Receiver) poolMismatches() []PoolMismatch {
+	r.peersMutex.Lock()
+	defer r.peersMutex.Unlock()
+
+	now := r.clock.Now()
+	mismatches := make([]PoolMismatch, 0)
+
+	for _, p := range r.peers {
+		if now.Sub(p.lastSeen) <= peerTimeout {
+			mismatches = append(mismatches, p.mismatch)
+		}
+	}
+
+	slices.SortFunc(mismatches, func(a, b PoolMismatch) int {
+		switch {
+		case a.Node < b.Node:
+			return -1
+		case a.Node > b.Node:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return mismatches
+}
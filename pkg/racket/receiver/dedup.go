@@ -0,0 +1,199 @@
+package racket
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+)
+
+const (
+	// Number of transmissions per publisher and stream within which copies
+	// are recognized
+	dedupWindow = 1024
+
+	// Paths are tracked in a bit mask
+	maxPaths = 64
+
+	// Publishers that have not been heard of for this long are forgotten
+	publisherTimeout = time.Minute
+)
+
+// PathStats counts the copies of messages received on one path, such as
+// "eth0/udp4".
+type PathStats struct {
+	// Received counts all copies that arrived on the path.
+	Received uint64
+
+	// First counts the copies that arrived before any other, and were
+	// dispatched.
+	First uint64
+
+	// Duplicates counts the copies that were dropped because the same
+	// transmission had already arrived.
+	Duplicates uint64
+
+	// Missed counts the transmissions that arrived on other paths, but
+	// not on this one. A path with a growing count is losing packets.
+	Missed uint64
+}
+
+// Publishers number the transmissions of each stream on their own.
+type windowKey struct {
+	publisher uint64
+	stream    stream.Stream
+}
+
+type publisherWindow struct {
+	highest  uint64
+	lastSeen time.Time
+
+	// Paths that delivered each of the last transmissions, indexed by
+	// sequence modulo the window size
+	masks [dedupWindow]uint64
+
+	// Paths that delivered anything of this publisher and stream
+	paths uint64
+}
+
+// deduplicator merges the copies of transmissions that arrive on redundant
+// paths. Only the first copy is accepted.
+type deduplicator struct {
+	mutex sync.Mutex
+
+	paths      map[string]int
+	names      []string
+	stats      []PathStats
+	publishers map[windowKey]*publisherWindow
+	lastPurge  time.Time
+}
+
+func newDeduplicator() *deduplicator {
+	return &deduplicator{
+		paths:      make(map[string]int),
+		publishers: make(map[windowKey]*publisherWindow),
+	}
+}
+
+func (d *deduplicator) pathIndex(path string) int {
+	if i, ok := d.paths[path]; ok {
+		return i
+	}
+
+	// Beyond the limit, paths share the last slot.
+	if len(d.names) == maxPaths {
+		return maxPaths - 1
+	}
+
+	i := len(d.names)
+	d.paths[path] = i
+	d.names = append(d.names, path)
+	d.stats = append(d.stats, PathStats{})
+
+	return i
+}
+
+// evict accounts for a transmission that leaves the window.
+func (d *deduplicator) evict(w *publisherWindow, mask uint64) {
+	if mask == 0 {
+		return
+	}
+
+	for missing := w.paths &^ mask; missing != 0; missing &= missing - 1 {
+		d.stats[bits.TrailingZeros64(missing)].Missed++
+	}
+}
+
+// accept reports whether the transmission o of stream s arriving on path is
+// the first copy.
+func (d *deduplicator) accept(o message.Origin, s stream.Stream, path string, now time.Time) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.purge(now)
+
+	p := d.pathIndex(path)
+	bit := uint64(1) << p
+	stats := &d.stats[p]
+
+	stats.Received++
+
+	k := windowKey{publisher: o.Publisher, stream: s}
+
+	w, ok := d.publishers[k]
+	if !ok {
+		w = &publisherWindow{
+			highest: o.Sequence,
+		}
+
+		d.publishers[k] = w
+	}
+
+	w.lastSeen = now
+	w.paths |= bit
+
+	switch {
+	case o.Sequence > w.highest:
+		if o.Sequence-w.highest >= dedupWindow {
+			for i := range w.masks {
+				d.evict(w, w.masks[i])
+				w.masks[i] = 0
+			}
+		} else {
+			for s := w.highest + 1; s <= o.Sequence; s++ {
+				d.evict(w, w.masks[s%dedupWindow])
+				w.masks[s%dedupWindow] = 0
+			}
+		}
+
+		w.highest = o.Sequence
+
+	case w.highest-o.Sequence >= dedupWindow:
+		// Too old to tell. Most likely, an earlier copy was accepted.
+		stats.Duplicates++
+		return false
+	}
+
+	slot := &w.masks[o.Sequence%dedupWindow]
+
+	if *slot != 0 {
+		*slot |= bit
+		stats.Duplicates++
+
+		return false
+	}
+
+	*slot = bit
+	stats.First++
+
+	return true
+}
+
+func (d *deduplicator) purge(now time.Time) {
+	if now.Sub(d.lastPurge) < publisherTimeout {
+		return
+	}
+
+	d.lastPurge = now
+
+	for k, w := range d.publishers {
+		if now.Sub(w.lastSeen) > publisherTimeout {
+			delete(d.publishers, k)
+		}
+	}
+}
+
+func (d *deduplicator) pathStats() map[string]PathStats {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	stats := make(map[string]PathStats, len(d.names))
+
+	for i, name := range d.names {
+		stats[name] = d.stats[i]
+	}
+
+	return stats
+}
@@ -0,0 +1,83 @@
+package racket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+)
+
+func TestDeduplicator(t *testing.T) {
+	d := newDeduplicator()
+	now := time.Now()
+
+	accept := func(seq uint64, path string) bool {
+		return d.accept(message.Origin{Publisher: 1, Sequence: seq}, "stream-1", path, now)
+	}
+
+	for _, tc := range []struct {
+		seq  uint64
+		path string
+		want bool
+	}{
+		{10, "a", true},
+		{10, "b", false},
+		{12, "b", true},
+		{11, "a", true},
+		{12, "a", false},
+		{11, "a", false},
+		{13, "a", true},
+	} {
+		if got := accept(tc.seq, tc.path); got != tc.want {
+			t.Errorf("sequence %d on %s: expected %v, got %v", tc.seq, tc.path, tc.want, got)
+		}
+	}
+
+	// Copies from other publishers are independent.
+	if !d.accept(message.Origin{Publisher: 2, Sequence: 10}, "stream-1", "a", now) {
+		t.Error("expected other publisher to be accepted")
+	}
+
+	// Push everything out of the window, which accounts for the missed
+	// copies: 11 and 13 never arrived on b.
+	if !accept(10+2*dedupWindow, "a") {
+		t.Error("expected new sequence to be accepted")
+	}
+
+	if accept(20, "b") {
+		t.Error("expected sequence behind the window to be dropped")
+	}
+
+	stats := d.pathStats()
+
+	if got := stats["a"]; got.Received != 7 || got.First != 5 || got.Duplicates != 2 || got.Missed != 0 {
+		t.Errorf("unexpected stats for a: %+v", got)
+	}
+
+	if got := stats["b"]; got.Received != 3 || got.First != 1 || got.Duplicates != 2 || got.Missed != 2 {
+		t.Errorf("unexpected stats for b: %+v", got)
+	}
+}
+
+func TestDeduplicator_Streams(t *testing.T) {
+	d := newDeduplicator()
+	now := time.Now()
+
+	if !d.accept(message.Origin{Publisher: 1, Sequence: 10}, "stream-1", "a", now) {
+		t.Fatal("expected first transmission to be accepted")
+	}
+
+	// A busy stream of the same publisher does not push the other one
+	// out of its window.
+	if !d.accept(message.Origin{Publisher: 1, Sequence: 10 + 2*dedupWindow}, "stream-2", "a", now) {
+		t.Fatal("expected transmission of the other stream to be accepted")
+	}
+
+	if !d.accept(message.Origin{Publisher: 1, Sequence: 9}, "stream-1", "b", now) {
+		t.Error("expected reordered transmission to be accepted")
+	}
+
+	if d.accept(message.Origin{Publisher: 1, Sequence: 10}, "stream-1", "b", now) {
+		t.Error("expected second copy to be dropped")
+	}
+}
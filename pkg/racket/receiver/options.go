@@ -0,0 +1,301 @@
+package racket
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/transport/udp"
+)
+
+type Opt interface {
+	apply(*Receiver)
+}
+
+type OptPools struct {
+	pools []*multicastpool.Pool
+}
+
+// Pools adds further pools to receive from. Passing an IPv6 pool in
+// addition to an IPv4 one makes the receiver dual-stack.
+func Pools(pools ...*multicastpool.Pool) Opt {
+	return &OptPools{
+		pools: pools,
+	}
+}
+
+func (o *OptPools) apply(r *Receiver) {
+	r.MulticastPools = append(r.MulticastPools, o.pools...)
+}
+
+type OptClock struct {
+	clock clock.Clock
+}
+
+// Clock sets the clock used for timeouts.
+func Clock(c clock.Clock) Opt {
+	return &OptClock{
+		clock: c,
+	}
+}
+
+func (o *OptClock) apply(r *Receiver) {
+	r.clock = o.clock
+}
+
+type OptLogger struct {
+	logger *slog.Logger
+}
+
+// Logger sets the logger. It defaults to slog.Default().
+func Logger(l *slog.Logger) Opt {
+	return &OptLogger{
+		logger: l,
+	}
+}
+
+func (o *OptLogger) apply(r *Receiver) {
+	r.logger = o.logger
+}
+
+type OptDeduplicate struct {
+	enabled bool
+}
+
+// Deduplicate controls whether copies of a message that arrive on more than
+// one path, such as on two interfaces connected to redundant networks, are
+// dropped. It is enabled by default. Per-path statistics are only kept while
+// it is enabled.
+func Deduplicate(enabled bool) Opt {
+	return &OptDeduplicate{
+		enabled: enabled,
+	}
+}
+
+func (o *OptDeduplicate) apply(r *Receiver) {
+	if !o.enabled {
+		r.dedup = nil
+	} else if r.dedup == nil {
+		r.dedup = newDeduplicator()
+	}
+}
+
+type OptCatchUp struct {
+	enabled bool
+}
+
+// CatchUp controls whether subscribing asks the senders to resend the
+// matching messages right away, rather than waiting for their intervals.
+// It is enabled by default.
+func CatchUp(enabled bool) Opt {
+	return &OptCatchUp{
+		enabled: enabled,
+	}
+}
+
+func (o *OptCatchUp) apply(r *Receiver) {
+	r.catchUp = o.enabled
+}
+
+type OptLastValueCache struct {
+	staleAfter time.Duration
+	streams    []stream.Stream
+}
+
+// LastValueCache keeps the last value of every subject of the given
+// streams, or of all streams if none are given, for Get and List. Values
+// that have not been received for staleAfter are dropped. Zero keeps them
+// until they are deleted.
+func LastValueCache(staleAfter time.Duration, streams ...stream.Stream) Opt {
+	return &OptLastValueCache{
+		staleAfter: staleAfter,
+		streams:    streams,
+	}
+}
+
+func (o *OptLastValueCache) apply(r *Receiver) {
+	r.cacheConfig = &cacheConfig{
+		staleAfter: o.staleAfter,
+		streams:    o.streams,
+	}
+}
+
+// The socket options below only take effect for receivers created with New.
+
+type OptTTL struct {
+	ttl int
+}
+
+// TTL sets the TTL or hop limit of outgoing multicast packets.
+func TTL(ttl int) Opt {
+	return &OptTTL{
+		ttl: ttl,
+	}
+}
+
+func (o *OptTTL) apply(r *Receiver) {
+	r.socket.TTL = o.ttl
+}
+
+type OptLoopback struct {
+	enabled bool
+}
+
+// Loopback controls whether outgoing multicast packets are delivered to
+// sockets on the same host. It is enabled by default.
+func Loopback(enabled bool) Opt {
+	return &OptLoopback{
+		enabled: enabled,
+	}
+}
+
+func (o *OptLoopback) apply(r *Receiver) {
+	r.socket.DisableLoopback = !o.enabled
+}
+
+type OptTOS struct {
+	tos int
+}
+
+// TOS sets the type of service or traffic class of outgoing packets.
+func TOS(tos int) Opt {
+	return &OptTOS{
+		tos: tos,
+	}
+}
+
+func (o *OptTOS) apply(r *Receiver) {
+	r.socket.TOS = o.tos
+}
+
+type OptDSCP struct {
+	dscp int
+}
+
+// DSCP sets the differentiated services code point of outgoing packets.
+func DSCP(dscp int) Opt {
+	return &OptDSCP{
+		dscp: dscp,
+	}
+}
+
+func (o *OptDSCP) apply(r *Receiver) {
+	r.socket.TOS = o.dscp << 2
+}
+
+type OptReceiveBuffer struct {
+	size int
+}
+
+// ReceiveBuffer sets the size of the socket receive buffers.
+func ReceiveBuffer(size int) Opt {
+	return &OptReceiveBuffer{
+		size: size,
+	}
+}
+
+func (o *OptReceiveBuffer) apply(r *Receiver) {
+	r.socket.ReceiveBuffer = o.size
+}
+
+type OptSendBuffer struct {
+	size int
+}
+
+// SendBuffer sets the size of the socket send buffers.
+func SendBuffer(size int) Opt {
+	return &OptSendBuffer{
+		size: size,
+	}
+}
+
+func (o *OptSendBuffer) apply(r *Receiver) {
+	r.socket.SendBuffer = o.size
+}
+
+type OptReusePort struct {
+	enabled bool
+}
+
+// ReusePort sets SO_REUSEPORT on the sockets, so that other processes can
+// bind the same ports.
+func ReusePort(enabled bool) Opt {
+	return &OptReusePort{
+		enabled: enabled,
+	}
+}
+
+func (o *OptReusePort) apply(r *Receiver) {
+	r.socket.ReusePort = o.enabled
+}
+
+type OptDispatchConcurrency struct {
+	concurrency int
+}
+
+// DispatchConcurrency limits the number of packets that are dispatched to
+// subscriptions at the same time. Zero means no limit. While the limit is
+// reached, sockets are not read, so packets that do not fit into the
+// receive buffer are dropped.
+func DispatchConcurrency(concurrency int) Opt {
+	return &OptDispatchConcurrency{
+		concurrency: concurrency,
+	}
+}
+
+func (o *OptDispatchConcurrency) apply(r *Receiver) {
+	r.concurrency = o.concurrency
+}
+
+type OptChangeCacheSize struct {
+	size int
+}
+
+// ChangeCacheSize sets the number of subjects per stream whose values are
+// remembered for subscriptions with subscription.OnlyOnChange. It defaults
+// to subscription.DefaultChangeCacheSize.
+func ChangeCacheSize(size int) Opt {
+	return &OptChangeCacheSize{
+		size: size,
+	}
+}
+
+func (o *OptChangeCacheSize) apply(r *Receiver) {
+	r.changeSize = o.size
+}
+
+type OptInterfaceEvents struct {
+	cb func(udp.Event)
+}
+
+// InterfaceEvents sets a callback that is told about interfaces going down
+// and coming back. Sockets are reopened and groups rejoined automatically.
+func InterfaceEvents(cb func(udp.Event)) Opt {
+	return &OptInterfaceEvents{
+		cb: cb,
+	}
+}
+
+func (o *OptInterfaceEvents) apply(r *Receiver) {
+	r.onInterfaceEvent = o.cb
+}
+
+type OptSelectInterfaces struct {
+	selector *ifselect.Selector
+}
+
+// SelectInterfaces picks the interfaces with a selector instead of a fixed
+// list, which must then be nil. The selection is updated whenever an
+// interface changes.
+func SelectInterfaces(sel *ifselect.Selector) Opt {
+	return &OptSelectInterfaces{
+		selector: sel,
+	}
+}
+
+func (o *OptSelectInterfaces) apply(r *Receiver) {
+	r.selector = o.selector
+}
@@ -1,43 +1,116 @@
 package racket
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"sync"
 	"sync/atomic"
 
+	"github.com/holoplot/go-racket/pkg/ifselect"
 	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/racket/clock"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
 	"github.com/holoplot/go-racket/pkg/racket/stream"
 	"github.com/holoplot/go-racket/pkg/racket/subject"
 	"github.com/holoplot/go-racket/pkg/racket/subscription"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+	"github.com/holoplot/go-racket/pkg/racket/transport/udp"
+)
+
+var (
+	ErrNoPool        = errors.New("no multicast pool")
+	ErrInvalidOption = errors.New("invalid option")
 )
 
 type Receiver struct {
 	mutex sync.Mutex
 
-	streams       map[stream.Stream]*receiverStream
-	MulticastPool *multicastpool.Pool
-	dispatcher    *multicast.Dispatcher
+	streams        map[stream.Stream]*receiverStream
+	MulticastPools []*multicastpool.Pool
+	transport      transport.Transport
+	ownTransport   bool
+	socket         multicast.SocketOptions
+	concurrency    int
+	changeSize     int
+	clock          clock.Clock
+	logger         *slog.Logger
+	dedup          *deduplicator
+	cacheConfig    *cacheConfig
+	catchUp        bool
+
+	selector         *ifselect.Selector
+	onInterfaceEvent func(udp.Event)
+
+	control []transport.Membership
+
+	sources       []net.IP
+	streamSources map[stream.Stream][]net.IP
+
+	peersMutex     sync.Mutex
+	peers          map[uint64]*peer
+	onPoolMismatch func(PoolMismatch)
+
+	// The caches of the streams in streams, which Get and List look up
+	// without taking mutex. Callbacks may call them while Subscribe holds
+	// mutex and waits for the dispatch to finish.
+	cachesMutex sync.Mutex
+	caches      map[stream.Stream]*lastValueCache
 }
 
 type receiverStream struct {
-	consumer         *multicast.Consumer
+	memberships      []transport.Membership
 	subscriptionTree *subscription.Tree
+	cache            *lastValueCache
 
 	messagesReceived   atomic.Uint64
 	messagesDispatched atomic.Uint64
 }
 
-func (r *Receiver) rawReceive(payload []byte) {
+func (rs *receiverStream) close() {
+	for _, m := range rs.memberships {
+		m.Close()
+	}
+}
+
+// handler returns the handler for the groups of stream s.
+func (r *Receiver) handler(s stream.Stream) transport.Handler {
+	return func(payload []byte, src net.Addr, path string) {
+		r.rawReceive(s, payload, src, path)
+	}
+}
+
+func (r *Receiver) rawReceive(s stream.Stream, payload []byte, src net.Addr, path string) {
 	msg, err := message.Parse(payload)
 	if err != nil {
-		panic(err)
+		r.logger.Debug("dropping malformed message", "source", src, "error", err)
+		return
+	}
+
+	// Streams that share a group end up in the handlers of all of them.
+	// Each one only takes its own.
+	if msg.Stream != s {
+		return
 	}
 
+	r.mutex.Lock()
 	stream, ok := r.streams[msg.Stream]
+	r.mutex.Unlock()
+
 	if !ok {
-		panic("stream not found")
+		return
+	}
+
+	// Only the first of the copies that arrive on redundant paths is
+	// dispatched.
+	if r.dedup != nil && msg.Origin.Publisher != 0 && !r.dedup.accept(msg.Origin, msg.Stream, path, r.clock.Now()) {
+		return
+	}
+
+	if stream.cache != nil {
+		stream.cache.update(msg, r.clock.Now())
 	}
 
 	d := stream.subscriptionTree.Dispatch(msg)
@@ -45,45 +118,122 @@ func (r *Receiver) rawReceive(payload []byte) {
 	stream.messagesDispatched.Add(d)
 }
 
+// Subscribe calls cb for all messages of stream with a subject matching
+// subject. With subscription.Replay, the cached values are delivered first.
 func (r *Receiver) Subscribe(stream stream.Stream, subject subject.Subject, cb subscription.Callback, opts ...subscription.Opt) (*subscription.Subscription, error) {
+	rs, sub, err := r.subscribe(stream, subject, cb, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Callbacks may call into the receiver, so the replay must happen
+	// without holding its lock.
+	d := rs.subscriptionTree.Replay(sub, func() []*message.Message {
+		if rs.cache == nil {
+			return nil
+		}
+
+		var msgs []*message.Message
+
+		for _, e := range rs.cache.list(subject, r.clock.Now()) {
+			msgs = append(msgs, e.Message)
+		}
+
+		return msgs
+	})
+
+	rs.messagesDispatched.Add(d)
+
+	if r.catchUp {
+		r.requestCatchUp(stream, subject)
+	}
+
+	return sub, nil
+}
+
+func (r *Receiver) subscribe(stream stream.Stream, subject subject.Subject, cb subscription.Callback, opts ...subscription.Opt) (*receiverStream, *subscription.Subscription, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	addr := r.MulticastPool.AddressForStream(stream)
+	if err := r.joinControl(); err != nil {
+		return nil, nil, fmt.Errorf("failed to join control group: %w", err)
+	}
 
 	rs, ok := r.streams[stream]
 	if !ok {
 		rs = &receiverStream{
-			subscriptionTree: subscription.NewTree(),
+			subscriptionTree: subscription.NewTree(
+				subscription.Clock(r.clock),
+				subscription.ChangeCacheSize(r.changeSize)),
 		}
 
-		var err error
+		rs.subscriptionTree.OnRemove(func() {
+			r.release(stream, rs)
+		})
 
-		rs.consumer, err = r.dispatcher.AddConsumer(addr, r.rawReceive)
-		if err != nil {
-			return nil, err
+		if r.cacheConfig.caches(stream) {
+			rs.cache = newLastValueCache(r.cacheConfig.staleAfter)
+		}
+
+		for _, pool := range r.MulticastPools {
+			sources, err := r.sourcesFor(stream, pool.Network())
+			if err != nil {
+				rs.close()
+				return nil, nil, err
+			}
+
+			addr := pool.AddressForStream(stream)
+
+			m, err := r.transport.Join(addr, r.handler(stream), sources...)
+			if err != nil {
+				rs.close()
+				return nil, nil, fmt.Errorf("failed to join group %s for stream %s: %w", addr, stream, err)
+			}
+
+			rs.memberships = append(rs.memberships, m)
+
+			r.logger.Debug("joined group", "stream", stream, "group", addr)
 		}
 
 		r.streams[stream] = rs
+
+		if rs.cache != nil {
+			r.cachesMutex.Lock()
+			r.caches[stream] = rs.cache
+			r.cachesMutex.Unlock()
+		}
 	}
 
 	sub := rs.subscriptionTree.Add(subject, cb, opts...)
 
-	return sub, nil
+	return rs, sub, nil
 }
 
+// Unsubscribe removes sub, like sub.Close does. The groups of the stream
+// are left when its last subscription is gone.
 func (r *Receiver) Unsubscribe(stream stream.Stream, sub *subscription.Subscription) error {
+	sub.Close()
+
+	return nil
+}
+
+// release leaves the groups of stream once its last subscription is gone.
+func (r *Receiver) release(stream stream.Stream, rs *receiverStream) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	g, ok := r.streams[stream]
-	if !ok {
-		return nil
+	if r.streams[stream] != rs || rs.subscriptionTree.Stats().SubscriptionsCount > 0 {
+		return
 	}
 
-	g.subscriptionTree.Remove(sub)
+	rs.close()
+	delete(r.streams, stream)
 
-	return nil
+	r.cachesMutex.Lock()
+	delete(r.caches, stream)
+	r.cachesMutex.Unlock()
+
+	r.logger.Debug("left groups", "stream", stream)
 }
 
 func (r *Receiver) Close() {
@@ -91,20 +241,127 @@ func (r *Receiver) Close() {
 	defer r.mutex.Unlock()
 
 	for _, g := range r.streams {
-		g.consumer.Close()
+		g.close()
+	}
+
+	for _, c := range r.control {
+		c.Close()
 	}
 
-	r.dispatcher.Close()
+	r.control = nil
+
+	if r.ownTransport {
+		r.transport.Close()
+	}
 
 	r.streams = make(map[stream.Stream]*receiverStream)
+
+	r.cachesMutex.Lock()
+	clear(r.caches)
+	r.cachesMutex.Unlock()
+}
+
+// New creates a receiver that listens via UDP multicast on the given
+// interfaces.
+func New(ifis []*net.Interface, pool *multicastpool.Pool, opts ...Opt) (*Receiver, error) {
+	r, err := newReceiver(pool, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.selector != nil {
+		if len(ifis) > 0 {
+			return nil, fmt.Errorf("%w: interfaces given along with a selector", ErrInvalidOption)
+		}
+
+		if ifis, err = r.selector.Select(); err != nil {
+			return nil, err
+		}
+	}
+
+	t := udp.New(ifis,
+		udp.Socket(r.socket),
+		udp.Concurrency(r.concurrency),
+		udp.Logger(r.logger),
+		udp.Selector(r.selector),
+		udp.OnEvent(r.onInterfaceEvent))
+
+	// Catch-up requests need sockets to send from.
+	if r.catchUp {
+		for _, pool := range r.MulticastPools {
+			if err := t.Open(pool.Network()); err != nil {
+				t.Close()
+				return nil, fmt.Errorf("failed to open sockets: %w", err)
+			}
+		}
+	}
+
+	r.transport = t
+	r.ownTransport = true
+
+	return r, nil
 }
 
-func New(ifis []*net.Interface, pool *multicastpool.Pool) *Receiver {
-	return &Receiver{
-		streams:       make(map[stream.Stream]*receiverStream),
-		dispatcher:    multicast.NewDispatcher(ifis),
-		MulticastPool: pool,
+// NewWithTransport creates a receiver that listens via the given transport.
+// The transport is not closed when the receiver is closed.
+func NewWithTransport(t transport.Transport, pool *multicastpool.Pool, opts ...Opt) (*Receiver, error) {
+	r, err := newReceiver(pool, opts...)
+	if err != nil {
+		return nil, err
 	}
+
+	r.transport = t
+
+	return r, nil
+}
+
+func newReceiver(pool *multicastpool.Pool, opts ...Opt) (*Receiver, error) {
+	if pool == nil {
+		return nil, ErrNoPool
+	}
+
+	r := &Receiver{
+		streams:        make(map[stream.Stream]*receiverStream),
+		clock:          clock.Real,
+		logger:         slog.Default(),
+		MulticastPools: []*multicastpool.Pool{pool},
+		peers:          make(map[uint64]*peer),
+		streamSources:  make(map[stream.Stream][]net.IP),
+		caches:         make(map[stream.Stream]*lastValueCache),
+		dedup:          newDeduplicator(),
+		changeSize:     subscription.DefaultChangeCacheSize,
+		catchUp:        true,
+	}
+
+	for _, opt := range opts {
+		opt.apply(r)
+	}
+
+	if r.concurrency < 0 {
+		return nil, fmt.Errorf("%w: dispatch concurrency %d", ErrInvalidOption, r.concurrency)
+	}
+
+	if r.changeSize < 1 {
+		return nil, fmt.Errorf("%w: change cache size %d", ErrInvalidOption, r.changeSize)
+	}
+
+	if r.clock == nil {
+		return nil, fmt.Errorf("%w: no clock", ErrInvalidOption)
+	}
+
+	if r.logger == nil {
+		return nil, fmt.Errorf("%w: no logger", ErrInvalidOption)
+	}
+
+	if err := r.socket.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+
+	if r.cacheConfig != nil && r.cacheConfig.staleAfter < 0 {
+		return nil, fmt.Errorf("%w: staleness %s", ErrInvalidOption, r.cacheConfig.staleAfter)
+	}
+
+	return r, nil
 }
 
 type StreamStats struct {
@@ -114,7 +371,11 @@ type StreamStats struct {
 }
 
 type Stats struct {
-	Streams map[stream.Stream]StreamStats
+	Streams        map[stream.Stream]StreamStats
+	PoolMismatches []PoolMismatch
+
+	// Paths is only set if duplicate suppression is enabled.
+	Paths map[string]PathStats
 }
 
 func (r *Receiver) Stats() Stats {
@@ -122,7 +383,12 @@ func (r *Receiver) Stats() Stats {
 	defer r.mutex.Unlock()
 
 	stats := Stats{
-		Streams: make(map[stream.Stream]StreamStats),
+		Streams:        make(map[stream.Stream]StreamStats),
+		PoolMismatches: r.poolMismatches(),
+	}
+
+	if r.dedup != nil {
+		stats.Paths = r.dedup.pathStats()
 	}
 
 	for stream, g := range r.streams {
@@ -0,0 +1,542 @@
+package racket
+
+import (
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	sender "github.com/holoplot/go-racket/pkg/racket/sender"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/subscription"
+	"github.com/holoplot/go-racket/pkg/racket/transport/memory"
+)
+
+func newTestPool(t *testing.T, s string) *multicastpool.Pool {
+	t.Helper()
+
+	pool, err := multicastpool.Parse(s)
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	return pool
+}
+
+func newTestPair(t *testing.T) (*sender.Sender, *Receiver, *memory.Bus) {
+	t.Helper()
+
+	pool := newTestPool(t, "239.1.0.0/16")
+	bus := memory.NewBus()
+
+	s, err := sender.NewWithTransport(bus.NewTransport(), pool)
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	r, err := NewWithTransport(bus.NewTransport(), pool)
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(func() {
+		s.Close()
+		r.Close()
+	})
+
+	return s, r, bus
+}
+
+func TestReceiver_Subscribe(t *testing.T) {
+	s, r, _ := newTestPair(t)
+
+	received := make(chan *message.Message, 16)
+
+	su, _ := subject.Parse("org.foo.*")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		received <- msg
+	}, subscription.OnlyOnChange()); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	for _, subj := range []string{"org.foo.a", "org.foo.b", "org.bar.c"} {
+		su, _ := subject.Parse(subj)
+
+		if err := s.Publish(&message.Message{
+			Stream:   "stream-1",
+			Subject:  su,
+			Data:     []byte(subj),
+			Interval: 10 * time.Millisecond,
+		}); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	seen := make(map[string]int)
+
+	timeout := time.After(200 * time.Millisecond)
+
+loop:
+	for {
+		select {
+		case msg := <-received:
+			seen[msg.Subject.String()]++
+		case <-timeout:
+			break loop
+		}
+	}
+
+	if len(seen) != 2 || seen["org.foo.a"] != 1 || seen["org.foo.b"] != 1 {
+		t.Errorf("expected each matching subject once, got %v", seen)
+	}
+
+	stats := r.Stats().Streams["stream-1"]
+	if stats.MessagesReceived < 6 || stats.MessagesDispatched != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReceiver_PoolMismatch(t *testing.T) {
+	bus := memory.NewBus()
+
+	r, err := NewWithTransport(bus.NewTransport(), newTestPool(t, "239.1.0.0/16"))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	mismatches := make(chan PoolMismatch, 4)
+	r.OnPoolMismatch(func(m PoolMismatch) {
+		mismatches <- m
+	})
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	good, err := sender.NewWithTransport(bus.NewTransport(), newTestPool(t, "239.1.0.0/16"))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(good.Close)
+
+	bad, err := sender.NewWithTransport(bus.NewTransport(), newTestPool(t, "239.1.0.0/17"))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(bad.Close)
+
+	select {
+	case m := <-mismatches:
+		if m.Node != bad.ID() || m.Pool != "239.1.0.0/17" {
+			t.Errorf("unexpected mismatch %+v", m)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for mismatch")
+	}
+
+	if m := r.Stats().PoolMismatches; len(m) != 1 || m[0].Node != bad.ID() {
+		t.Errorf("expected one mismatch in stats, got %+v", m)
+	}
+}
+
+func TestReceiver_PoolMismatchTimeout(t *testing.T) {
+	bus := memory.NewBus()
+	c := clock.NewFake(time.Now())
+
+	r, err := NewWithTransport(bus.NewTransport(), newTestPool(t, "239.1.0.0/16"), Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	mismatches := make(chan PoolMismatch, 16)
+
+	r.OnPoolMismatch(func(m PoolMismatch) {
+		mismatches <- m
+	})
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	bad, err := sender.NewWithTransport(bus.NewTransport(), newTestPool(t, "239.1.0.0/17"), sender.Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	// The first announcement is sent right away, but only once the ticker
+	// of the sender exists, so the clock must not move before it arrived.
+	select {
+	case <-mismatches:
+	case <-time.After(time.Second):
+		t.Fatal("mismatch not reported")
+	}
+
+	if m := r.Stats().PoolMismatches; len(m) != 1 {
+		t.Fatalf("expected one mismatch, got %+v", m)
+	}
+
+	bad.Close()
+	c.Advance(peerTimeout + time.Second)
+
+	if m := r.Stats().PoolMismatches; len(m) != 0 {
+		t.Errorf("expected mismatch to expire, got %+v", m)
+	}
+}
+
+func TestNewWithTransport_InvalidOptions(t *testing.T) {
+	pool := newTestPool(t, "239.1.0.0/16")
+
+	for _, opt := range []Opt{
+		TTL(-1),
+		DSCP(64),
+		ReceiveBuffer(-1),
+		DispatchConcurrency(-1),
+		ChangeCacheSize(0),
+		Clock(nil),
+		Logger(nil),
+	} {
+		if _, err := NewWithTransport(memory.NewBus().NewTransport(), pool, opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected invalid option error for %+v, got %v", opt, err)
+		}
+	}
+
+	if _, err := NewWithTransport(memory.NewBus().NewTransport(), nil); !errors.Is(err, ErrNoPool) {
+		t.Errorf("expected error without pool, got %v", err)
+	}
+}
+
+func TestReceiver_MalformedMessage(t *testing.T) {
+	s, r, bus := newTestPair(t)
+
+	received := make(chan *message.Message, 16)
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		received <- msg
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	addr := r.MulticastPools[0].AddressForStream("stream-1")
+	if err := bus.NewTransport().Send([]byte("garbage"), addr); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	su, _ = subject.Parse("org.foo")
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Second,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("message not received after malformed one")
+	}
+}
+
+func TestReceiver_RedundantPaths(t *testing.T) {
+	_, r, _ := newTestPair(t)
+
+	received := make(chan *message.Message, 16)
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		received <- msg
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	su, _ = subject.Parse("org.foo")
+	m := &message.Message{
+		Stream:  "stream-1",
+		Subject: su,
+		Data:    []byte("foo"),
+	}
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		payload, err := m.MarshalBinaryWithOrigin(message.Origin{Publisher: 1, Sequence: seq})
+		if err != nil {
+			t.Fatalf("failed to marshal: %v", err)
+		}
+
+		r.rawReceive("stream-1", payload, nil, "eth0/udp4")
+
+		// The second copy of the last transmission is lost.
+		if seq < 3 {
+			r.rawReceive("stream-1", payload, nil, "eth1/udp4")
+		}
+	}
+
+	if got := r.Stats().Streams["stream-1"].MessagesReceived; got != 3 {
+		t.Errorf("expected 3 messages, got %d", got)
+	}
+
+	paths := r.Stats().Paths
+	if got := paths["eth0/udp4"]; got.Received != 3 || got.First != 3 || got.Duplicates != 0 {
+		t.Errorf("unexpected stats for eth0: %+v", got)
+	}
+
+	if got := paths["eth1/udp4"]; got.Received != 2 || got.First != 0 || got.Duplicates != 2 {
+		t.Errorf("unexpected stats for eth1: %+v", got)
+	}
+}
+
+func TestReceiver_RedundantPathsDisabled(t *testing.T) {
+	r, err := NewWithTransport(memory.NewBus().NewTransport(), newTestPool(t, "239.1.0.0/16"), Deduplicate(false))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	su, _ = subject.Parse("org.foo")
+	payload, err := (&message.Message{Stream: "stream-1", Subject: su}).
+		MarshalBinaryWithOrigin(message.Origin{Publisher: 1, Sequence: 1})
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	r.rawReceive("stream-1", payload, nil, "eth0/udp4")
+	r.rawReceive("stream-1", payload, nil, "eth1/udp4")
+
+	if got := r.Stats().Streams["stream-1"].MessagesReceived; got != 2 {
+		t.Errorf("expected both copies, got %d", got)
+	}
+
+	if r.Stats().Paths != nil {
+		t.Error("expected no path stats")
+	}
+}
+
+func TestReceiver_Unsubscribe(t *testing.T) {
+	_, r, bus := newTestPair(t)
+
+	addr := r.MulticastPools[0].AddressForStream("stream-1").String()
+
+	su, _ := subject.Parse("org.*")
+
+	subs := make([]*subscription.Subscription, 2)
+	for i := range subs {
+		sub, err := r.Subscribe("stream-1", su, func(*message.Message) {})
+		if err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+
+		subs[i] = sub
+	}
+
+	if err := r.Unsubscribe("stream-1", subs[0]); err != nil {
+		t.Fatalf("failed to unsubscribe: %v", err)
+	}
+
+	if !slices.Contains(bus.Groups(), addr) {
+		t.Errorf("expected %s to stay joined, got %v", addr, bus.Groups())
+	}
+
+	// The handle removes itself just as well.
+	subs[1].Close()
+
+	if slices.Contains(bus.Groups(), addr) {
+		t.Errorf("expected %s to be left, got %v", addr, bus.Groups())
+	}
+
+	if _, ok := r.Stats().Streams["stream-1"]; ok {
+		t.Error("expected stream to be gone from stats")
+	}
+
+	// Subscribing again joins again.
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if !slices.Contains(bus.Groups(), addr) {
+		t.Errorf("expected %s to be joined again, got %v", addr, bus.Groups())
+	}
+}
+
+func TestReceiver_SubscribeFromCallback(t *testing.T) {
+	s, r, _ := newTestPair(t)
+
+	su, _ := subject.Parse("org.*")
+
+	other, err := r.Subscribe("stream-2", su, func(*message.Message) {})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	errs := make(chan error, 1)
+
+	// While a callback runs, the stream can be subscribed to, and closing
+	// the last subscription of another stream leaves its groups.
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {
+		subscribed := make(chan error, 1)
+
+		go func() {
+			_, err := r.Subscribe("stream-1", su, func(*message.Message) {})
+			subscribed <- err
+		}()
+
+		select {
+		case err := <-subscribed:
+			errs <- err
+		case <-time.After(time.Second):
+			errs <- errors.New("subscribe blocked on the callback")
+		}
+
+		other.Close()
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	published := make(chan error, 1)
+	foo, _ := subject.Parse("org.foo")
+
+	go func() {
+		published <- s.Publish(&message.Message{Stream: "stream-1", Subject: foo, Interval: time.Hour})
+	}()
+
+	select {
+	case err := <-published:
+		if err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("callback blocked on the receiver")
+	}
+
+	if err := <-errs; err != nil {
+		t.Error(err)
+	}
+
+	if _, ok := r.Stats().Streams["stream-2"]; ok {
+		t.Error("expected stream-2 to be gone from stats")
+	}
+}
+
+func TestReceiver_SharedGroup(t *testing.T) {
+	// All streams of a single-address pool share one group.
+	pool := newTestPool(t, "239.1.2.3/32")
+	bus := memory.NewBus()
+
+	s, err := sender.NewWithTransport(bus.NewTransport(), pool)
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	// Without duplicate suppression, the stream of a message alone decides
+	// where it goes.
+	r, err := NewWithTransport(bus.NewTransport(), pool, Deduplicate(false))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	var received [2]atomic.Int32
+
+	su, _ := subject.Parse("org.*")
+	for i, st := range []stream.Stream{"stream-1", "stream-2"} {
+		if _, err := r.Subscribe(st, su, func(*message.Message) {
+			received[i].Add(1)
+		}); err != nil {
+			t.Fatalf("failed to subscribe: %v", err)
+		}
+	}
+
+	su, _ = subject.Parse("org.foo")
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Hour,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	if got := received[0].Load(); got != 1 {
+		t.Errorf("expected one message on stream-1, got %d", got)
+	}
+
+	if got := received[1].Load(); got != 0 {
+		t.Errorf("expected no message on stream-2, got %d", got)
+	}
+}
+
+func TestReceiver_CatchUp(t *testing.T) {
+	s, r, c := newTestCache(t)
+
+	publish(t, s, "org.foo", "1")
+	publish(t, s, "org.bar", "2")
+
+	var got [2]atomic.Int32
+
+	su, _ := subject.Parse("org.foo")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {
+		got[0].Add(1)
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	// The answer is delayed by up to the jitter.
+	c.Advance(sender.DefaultCatchUpPolicy.Jitter)
+
+	if n := got[0].Load(); n != 1 {
+		t.Fatalf("expected the message to be resent, got %d", n)
+	}
+
+	// Within the minimum interval, further requests are not answered.
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {
+		got[1].Add(1)
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	c.Advance(sender.DefaultCatchUpPolicy.Jitter)
+
+	if n := got[1].Load(); n != 0 {
+		t.Errorf("expected no resend within the minimum interval, got %d", n)
+	}
+
+	if n := s.Stats().Streams["stream-1"].MessagesSent; n != 3 {
+		t.Errorf("expected 3 messages sent, got %d", n)
+	}
+}
+
+func TestReceiver_ChangeCacheSize(t *testing.T) {
+	s, r, _ := newTestCache(t, ChangeCacheSize(1))
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(*message.Message) {}, subscription.OnlyOnChange()); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	publish(t, s, "org.foo", "1")
+	publish(t, s, "org.bar", "1")
+
+	if n := r.Stats().Streams["stream-1"].SubscriptionStats.ChangeCacheCount; n != 1 {
+		t.Errorf("expected 1 remembered subject, got %d", n)
+	}
+}
@@ -0,0 +1,74 @@
+package racket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+)
+
+var (
+	ErrStreamActive = errors.New("stream is already subscribed")
+	ErrNoSources    = errors.New("no source matches the pool's network")
+)
+
+// SetSources restricts the streams that are subscribed to from now on to
+// the given publisher addresses, using source-specific multicast (SSM)
+// joins. This requires pools in 232.0.0.0/8 or ff3x::/32. Passing no
+// sources reverts to any-source joins.
+func (r *Receiver) SetSources(sources ...net.IP) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.sources = slices.Clone(sources)
+}
+
+// SetStreamSources restricts a single stream to the given publisher
+// addresses, taking precedence over SetSources. It must be called before
+// the stream is subscribed to.
+func (r *Receiver) SetStreamSources(s stream.Stream, sources ...net.IP) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.streams[s]; ok {
+		return fmt.Errorf("%w: %s", ErrStreamActive, s)
+	}
+
+	if len(sources) == 0 {
+		delete(r.streamSources, s)
+	} else {
+		r.streamSources[s] = slices.Clone(sources)
+	}
+
+	return nil
+}
+
+// sourcesFor returns the sources to join for a stream in a given network.
+// It must be called with the receiver's mutex held.
+func (r *Receiver) sourcesFor(s stream.Stream, network string) ([]net.IP, error) {
+	sources, ok := r.streamSources[s]
+	if !ok {
+		sources = r.sources
+	}
+
+	if len(sources) == 0 {
+		return nil, nil
+	}
+
+	filtered := make([]net.IP, 0, len(sources))
+
+	for _, source := range sources {
+		if multicast.Network(source) == network {
+			filtered = append(filtered, source)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return nil, fmt.Errorf("%w: stream %s, network %s", ErrNoSources, s, network)
+	}
+
+	return filtered, nil
+}
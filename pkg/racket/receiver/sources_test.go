@@ -0,0 +1,149 @@
+package racket
+
+import (
+	"errors"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	sender "github.com/holoplot/go-racket/pkg/racket/sender"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/transport/memory"
+)
+
+func TestReceiver_SourcesFor(t *testing.T) {
+	r, err := NewWithTransport(memory.NewBus().NewTransport(), newTestPool(t, "232.1.0.0/16"))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	v4a, v4b, v6 := net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), net.ParseIP("fd00::1")
+
+	// Without sources, streams are joined for any source.
+	if sources, err := r.sourcesFor("stream-1", multicast.NetworkIPv4); err != nil || sources != nil {
+		t.Errorf("expected any source, got %v, %v", sources, err)
+	}
+
+	r.SetSources(v4a, v6)
+
+	if sources, err := r.sourcesFor("stream-1", multicast.NetworkIPv4); err != nil || !slices.EqualFunc(sources, []net.IP{v4a}, net.IP.Equal) {
+		t.Errorf("expected the IPv4 source, got %v, %v", sources, err)
+	}
+
+	if sources, err := r.sourcesFor("stream-1", multicast.NetworkIPv6); err != nil || !slices.EqualFunc(sources, []net.IP{v6}, net.IP.Equal) {
+		t.Errorf("expected the IPv6 source, got %v, %v", sources, err)
+	}
+
+	// Sources of a stream take precedence.
+	if err := r.SetStreamSources("stream-2", v4b); err != nil {
+		t.Fatalf("failed to set stream sources: %v", err)
+	}
+
+	if sources, err := r.sourcesFor("stream-2", multicast.NetworkIPv4); err != nil || !slices.EqualFunc(sources, []net.IP{v4b}, net.IP.Equal) {
+		t.Errorf("expected the stream's source, got %v, %v", sources, err)
+	}
+
+	if _, err := r.sourcesFor("stream-2", multicast.NetworkIPv6); !errors.Is(err, ErrNoSources) {
+		t.Errorf("expected ErrNoSources, got %v", err)
+	}
+
+	// Setting no sources for a stream falls back to the receiver's.
+	if err := r.SetStreamSources("stream-2"); err != nil {
+		t.Fatalf("failed to clear stream sources: %v", err)
+	}
+
+	if sources, err := r.sourcesFor("stream-2", multicast.NetworkIPv4); err != nil || !slices.EqualFunc(sources, []net.IP{v4a}, net.IP.Equal) {
+		t.Errorf("expected the receiver's source, got %v, %v", sources, err)
+	}
+}
+
+func TestReceiver_StreamSources(t *testing.T) {
+	pool := newTestPool(t, "232.1.0.0/16")
+	bus := memory.NewBus()
+
+	var (
+		senders    []*sender.Sender
+		transports []*memory.Transport
+	)
+
+	for range 2 {
+		st := bus.NewTransport()
+
+		s, err := sender.NewWithTransport(st, pool)
+		if err != nil {
+			t.Fatalf("failed to create sender: %v", err)
+		}
+
+		t.Cleanup(s.Close)
+		senders = append(senders, s)
+		transports = append(transports, st)
+	}
+
+	r, err := NewWithTransport(bus.NewTransport(), pool)
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	if err := r.SetStreamSources("stream-1", net.ParseIP("fd00::1")); err != nil {
+		t.Fatalf("failed to set stream sources: %v", err)
+	}
+
+	su, _ := subject.Parse("org.*")
+	cb := func(*message.Message) {}
+
+	if _, err := r.Subscribe("stream-1", su, cb); !errors.Is(err, ErrNoSources) {
+		t.Errorf("expected ErrNoSources, got %v", err)
+	}
+
+	// Only the second sender is accepted.
+	trusted := transports[1].Addr(pool.AddressForStream("stream-1").IP)
+
+	if err := r.SetStreamSources("stream-1", trusted.IP); err != nil {
+		t.Fatalf("failed to set stream sources: %v", err)
+	}
+
+	received := make(chan string, 16)
+
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		received <- string(msg.Data)
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	if err := r.SetStreamSources("stream-1"); !errors.Is(err, ErrStreamActive) {
+		t.Errorf("expected ErrStreamActive, got %v", err)
+	}
+
+	for i, s := range senders {
+		if err := s.Publish(&message.Message{
+			Stream:   "stream-1",
+			Subject:  subject.Subject{Parts: []string{"org", "foo"}},
+			Data:     []byte{'0' + byte(i)},
+			Interval: time.Hour,
+		}); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	select {
+	case data := <-received:
+		if data != "1" {
+			t.Errorf("expected only the trusted sender's message, got %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+
+	select {
+	case data := <-received:
+		t.Errorf("unexpected message %q", data)
+	default:
+	}
+}
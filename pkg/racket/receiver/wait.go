@@ -0,0 +1,139 @@
+package racket
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/subscription"
+)
+
+// WaitFor blocks until a value of subject in stream is available and returns
+// it. Cached values are returned right away. Tombstones are skipped.
+func (r *Receiver) WaitFor(ctx context.Context, stream stream.Stream, subj subject.Subject) (*message.Message, error) {
+	if subj.HasWildcard() {
+		return nil, fmt.Errorf("wildcard in subject not allowed")
+	}
+
+	var (
+		mutex sync.Mutex
+		value *message.Message
+	)
+
+	// Callbacks must not block, as the subscription is removed while
+	// they may run.
+	notify := make(chan struct{}, 1)
+
+	sub, err := r.Subscribe(stream, subj, func(msg *message.Message) {
+		if msg.Tombstone || msg.Subject.String() != subj.String() {
+			return
+		}
+
+		mutex.Lock()
+		if value == nil {
+			value = msg
+		}
+		mutex.Unlock()
+
+		select {
+		case notify <- struct{}{}:
+		default:
+		}
+	}, subscription.Replay())
+	if err != nil {
+		return nil, err
+	}
+
+	defer sub.Close()
+
+	select {
+	case <-notify:
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		return value, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// WaitForSettled blocks until the subjects in stream that match pattern
+// have settled, which is when none of them appeared, changed or was deleted
+// for quiet, and returns their values sorted by subject. To include the
+// answers to the catch-up request, quiet should exceed the senders' jitter.
+func (r *Receiver) WaitForSettled(ctx context.Context, stream stream.Stream, pattern subject.Subject, quiet time.Duration) ([]*message.Message, error) {
+	if quiet <= 0 {
+		return nil, fmt.Errorf("%w: quiet period %s", ErrInvalidOption, quiet)
+	}
+
+	var (
+		mutex      sync.Mutex
+		values     = make(map[string]*message.Message)
+		lastChange = r.clock.Now()
+	)
+
+	sub, err := r.Subscribe(stream, pattern, func(msg *message.Message) {
+		k := msg.Subject.String()
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		old, ok := values[k]
+
+		switch {
+		case msg.Tombstone && ok:
+			delete(values, k)
+		case msg.Tombstone, ok && old.Hash() == msg.Hash():
+			return
+		default:
+			values[k] = msg
+		}
+
+		lastChange = r.clock.Now()
+	}, subscription.Replay())
+	if err != nil {
+		return nil, err
+	}
+
+	defer sub.Close()
+
+	timer := r.clock.NewTimer(quiet)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		mutex.Lock()
+
+		// Changes since the timer was set push the deadline back.
+		if wait := quiet - r.clock.Now().Sub(lastChange); wait > 0 {
+			mutex.Unlock()
+			timer.Reset(wait)
+
+			continue
+		}
+
+		msgs := make([]*message.Message, 0, len(values))
+		for _, msg := range values {
+			msgs = append(msgs, msg)
+		}
+
+		mutex.Unlock()
+
+		slices.SortFunc(msgs, func(a, b *message.Message) int {
+			return strings.Compare(a.Subject.String(), b.Subject.String())
+		})
+
+		return msgs, nil
+	}
+}
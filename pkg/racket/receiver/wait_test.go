@@ -0,0 +1,111 @@
+package racket
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+func TestReceiver_WaitFor(t *testing.T) {
+	s, r, _ := newTestCache(t, LastValueCache(0))
+
+	su, _ := subject.Parse("org.foo")
+
+	// A cached value is returned right away.
+	publish(t, s, "org.foo", "1")
+
+	msg, err := r.WaitFor(context.Background(), "stream-1", su)
+	if err != nil || string(msg.Data) != "1" {
+		t.Fatalf("expected the cached value, got %v, %v", msg, err)
+	}
+
+	// Otherwise, WaitFor blocks until the value arrives.
+	su, _ = subject.Parse("org.bar")
+	result := make(chan *message.Message, 1)
+
+	go func() {
+		msg, err := r.WaitFor(context.Background(), "stream-1", su)
+		if err != nil {
+			t.Errorf("failed to wait: %v", err)
+		}
+
+		result <- msg
+	}()
+
+	deadline := time.After(time.Second)
+
+	for {
+		publish(t, s, "org.bar.baz", "other")
+		publish(t, s, "org.bar", "2")
+
+		select {
+		case msg := <-result:
+			if msg == nil || string(msg.Data) != "2" {
+				t.Errorf("unexpected value %v", msg)
+			}
+
+			return
+		case <-deadline:
+			t.Fatal("value not received")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestReceiver_WaitForCancel(t *testing.T) {
+	_, r, _ := newTestCache(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	su, _ := subject.Parse("org.foo")
+	if _, err := r.WaitFor(ctx, "stream-1", su); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+
+	su, _ = subject.Parse("org.*")
+	if _, err := r.WaitForSettled(ctx, "stream-1", su, time.Second); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancellation, got %v", err)
+	}
+}
+
+func TestReceiver_WaitForSettled(t *testing.T) {
+	s, r, c := newTestCache(t, LastValueCache(0), CatchUp(false))
+
+	publish(t, s, "org.b", "2")
+	publish(t, s, "org.a", "1")
+	publish(t, s, "other", "3")
+
+	// Wait for the tickers of the announcements and the resends.
+	c.BlockUntil(4)
+
+	n := c.Waiters()
+	result := make(chan []*message.Message, 1)
+
+	go func() {
+		su, _ := subject.Parse("org.*")
+
+		msgs, err := r.WaitForSettled(context.Background(), "stream-1", su, time.Second)
+		if err != nil {
+			t.Errorf("failed to wait: %v", err)
+		}
+
+		result <- msgs
+	}()
+
+	c.BlockUntil(n + 1)
+	c.Advance(time.Second)
+
+	select {
+	case msgs := <-result:
+		if len(msgs) != 2 || string(msgs[0].Data) != "1" || string(msgs[1].Data) != "2" {
+			t.Errorf("unexpected values %v", msgs)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not settled")
+	}
+}
@@ -0,0 +1,45 @@
+package racket
+
+import (
+	"context"
+
+	"github.com/holoplot/go-racket/pkg/racket/control"
+	"github.com/holoplot/go-racket/pkg/racket/global"
+)
+
+func (s *Sender) sendAnnouncement() {
+	for _, pool := range s.pools {
+		a := &control.Announcement{
+			Node:        s.id,
+			Fingerprint: pool.Fingerprint(),
+			Pool:        pool.String(),
+		}
+
+		payload, err := a.MarshalBinary()
+		if err != nil {
+			s.logger.Error("failed to marshal announcement", "error", err)
+			continue
+		}
+
+		if err := s.transport.Send(payload, pool.ControlAddress()); err != nil {
+			s.logger.Warn("failed to send announcement", "group", pool.ControlAddress(), "error", err)
+		}
+	}
+}
+
+// announce periodically advertises the fingerprint of the pool configuration
+// so that receivers can detect nodes that map streams differently.
+func (s *Sender) announce(ctx context.Context) {
+	ticker := s.clock.NewTicker(global.AnnounceInterval)
+	defer ticker.Stop()
+
+	for {
+		s.sendAnnouncement()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package racket
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/control"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+// CatchUpPolicy controls how catch-up requests of receivers that join a
+// stream are answered. The matching messages are resent after a random
+// delay of up to Jitter, so that not all senders answer at once. Requests
+// that arrive in the meantime are answered along. Each message is resent
+// at most once per MinInterval. The zero value ignores requests.
+type CatchUpPolicy struct {
+	Jitter      time.Duration
+	MinInterval time.Duration
+}
+
+var DefaultCatchUpPolicy = CatchUpPolicy{
+	Jitter:      100 * time.Millisecond,
+	MinInterval: time.Second,
+}
+
+func (p CatchUpPolicy) validate() error {
+	if p.Jitter < 0 || p.MinInterval < 0 {
+		return fmt.Errorf("%w: catch-up policy %v/%v", ErrInvalidOption, p.Jitter, p.MinInterval)
+	}
+
+	return nil
+}
+
+func (p CatchUpPolicy) enabled() bool {
+	return p.MinInterval > 0
+}
+
+// joinControl joins the control groups of the pools to receive catch-up
+// requests.
+func (s *Sender) joinControl() error {
+	joined := make(map[string]bool)
+
+	for _, pool := range s.pools {
+		addr := pool.ControlAddress()
+
+		if joined[addr.String()] {
+			continue
+		}
+
+		m, err := s.transport.Join(addr, s.controlReceive)
+		if err != nil {
+			for _, m := range s.control {
+				m.Close()
+			}
+
+			s.control = nil
+
+			return fmt.Errorf("failed to join control group %s: %w", addr, err)
+		}
+
+		s.control = append(s.control, m)
+		joined[addr.String()] = true
+	}
+
+	return nil
+}
+
+func (s *Sender) controlReceive(payload []byte, src net.Addr, _ string) {
+	m, err := control.Parse(payload)
+	if err != nil {
+		s.logger.Debug("dropping control message", "source", src, "error", err)
+		return
+	}
+
+	c, ok := m.(*control.CatchUp)
+	if !ok {
+		return
+	}
+
+	s.lock.RLock()
+	sg := s.senderStreams[c.Stream]
+	s.lock.RUnlock()
+
+	if sg != nil {
+		sg.requestCatchUp(c.Subject)
+	}
+}
+
+func (sg *senderStream) requestCatchUp(pattern subject.Subject) {
+	sg.lock.Lock()
+	defer sg.lock.Unlock()
+
+	sg.catchUpPatterns = append(sg.catchUpPatterns, pattern)
+
+	// An answer is already pending
+	if len(sg.catchUpPatterns) > 1 {
+		return
+	}
+
+	var delay time.Duration
+
+	if sg.catchUp.Jitter > 0 {
+		delay = rand.N(sg.catchUp.Jitter)
+	}
+
+	sg.clock.AfterFunc(delay, sg.answerCatchUp)
+}
+
+func (sg *senderStream) answerCatchUp() {
+	now := sg.clock.Now()
+
+	sg.lock.Lock()
+
+	patterns := sg.catchUpPatterns
+	sg.catchUpPatterns = nil
+
+	var due []*queuedMessage
+
+	for _, qm := range sg.messages {
+		if !slices.ContainsFunc(patterns, func(p subject.Subject) bool {
+			return p.Matches(qm.msg.Subject)
+		}) {
+			continue
+		}
+
+		if !qm.lastCatchUp.IsZero() && now.Sub(qm.lastCatchUp) < sg.catchUp.MinInterval {
+			continue
+		}
+
+		qm.lastCatchUp = now
+		due = append(due, qm)
+	}
+
+	sg.lock.Unlock()
+
+	for _, qm := range due {
+		err := sg.send(qm.ctx, qm.msg, sg.addresses(qm.msg.Stream))
+		if err == nil || qm.ctx.Err() != nil {
+			continue
+		}
+
+		for _, e := range sendErrors(err) {
+			sg.report(e)
+		}
+	}
+}
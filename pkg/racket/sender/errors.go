@@ -0,0 +1,115 @@
+package racket
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+)
+
+// SendError describes a failure to send a message to one group, on one
+// interface if the transport tells them apart.
+type SendError struct {
+	Stream    stream.Stream
+	Subject   subject.Subject
+	Group     *net.UDPAddr
+	Interface string
+	Err       error
+}
+
+func (e *SendError) Error() string {
+	s := fmt.Sprintf("failed to send %s/%s to group %s", e.Stream, e.Subject, e.Group)
+
+	if e.Interface != "" {
+		s += " on " + e.Interface
+	}
+
+	return s + ": " + e.Err.Error()
+}
+
+func (e *SendError) Unwrap() error {
+	return e.Err
+}
+
+// newSendErrors splits an error returned by a transport into one SendError
+// per interface.
+func newSendErrors(st stream.Stream, su subject.Subject, group *net.UDPAddr, err error) []error {
+	if pe, ok := err.(*transport.PartialError); ok {
+		return newSendErrors(st, su, group, pe.Err)
+	}
+
+	var errs []error
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, newSendErrors(st, su, group, err)...)
+		}
+
+		return errs
+	}
+
+	e := &SendError{
+		Stream:  st,
+		Subject: su,
+		Group:   group,
+		Err:     err,
+	}
+
+	var ie *transport.InterfaceError
+	if errors.As(err, &ie) {
+		e.Interface = ie.Interface
+		e.Err = ie.Err
+	}
+
+	return append(errs, e)
+}
+
+// sendErrors returns the SendErrors contained in err.
+func sendErrors(err error) []*SendError {
+	if pe, ok := err.(*transport.PartialError); ok {
+		return sendErrors(pe.Err)
+	}
+
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []*SendError
+
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, sendErrors(err)...)
+		}
+
+		return errs
+	}
+
+	var se *SendError
+	if errors.As(err, &se) {
+		return []*SendError{se}
+	}
+
+	return nil
+}
+
+// OnSendError registers a callback that is called for every failure to
+// resend a queued message in the background, and for the groups and
+// interfaces a message or tombstone did not reach when others did.
+func (s *Sender) OnSendError(cb func(*SendError)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.onSendError = cb
+}
+
+func (s *Sender) reportSendError(e *SendError) {
+	s.lock.RLock()
+	cb := s.onSendError
+	s.lock.RUnlock()
+
+	s.logger.Error("failed to send message",
+		"stream", e.Stream, "subject", e.Subject, "group", e.Group, "interface", e.Interface, "error", e.Err)
+
+	if cb != nil {
+		cb(e)
+	}
+}
@@ -0,0 +1,254 @@
+package racket
+
+import (
+	"log/slog"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/transport/udp"
+)
+
+type Opt interface {
+	apply(*Sender)
+}
+
+type OptPools struct {
+	pools []*multicastpool.Pool
+}
+
+// Pools adds further pools to publish to. Passing an IPv6 pool in addition
+// to an IPv4 one makes the sender dual-stack.
+func Pools(pools ...*multicastpool.Pool) Opt {
+	return &OptPools{
+		pools: pools,
+	}
+}
+
+func (o *OptPools) apply(s *Sender) {
+	s.pools = append(s.pools, o.pools...)
+}
+
+type OptClock struct {
+	clock clock.Clock
+}
+
+// Clock sets the clock that drives the periodic resend and announcements
+// and that messages are stamped with.
+func Clock(c clock.Clock) Opt {
+	return &OptClock{
+		clock: c,
+	}
+}
+
+func (o *OptClock) apply(s *Sender) {
+	s.clock = o.clock
+}
+
+type OptLogger struct {
+	logger *slog.Logger
+}
+
+// Logger sets the logger. It defaults to slog.Default().
+func Logger(l *slog.Logger) Opt {
+	return &OptLogger{
+		logger: l,
+	}
+}
+
+func (o *OptLogger) apply(s *Sender) {
+	s.logger = o.logger
+}
+
+type OptRetry struct {
+	policy RetryPolicy
+}
+
+// Retry sets the policy for retrying failed transmissions. It defaults to
+// DefaultRetryPolicy.
+func Retry(p RetryPolicy) Opt {
+	return &OptRetry{
+		policy: p,
+	}
+}
+
+func (o *OptRetry) apply(s *Sender) {
+	s.retry = o.policy
+}
+
+type OptCatchUp struct {
+	policy CatchUpPolicy
+}
+
+// CatchUp sets the policy for answering catch-up requests of receivers. It
+// defaults to DefaultCatchUpPolicy.
+func CatchUp(p CatchUpPolicy) Opt {
+	return &OptCatchUp{
+		policy: p,
+	}
+}
+
+func (o *OptCatchUp) apply(s *Sender) {
+	s.catchUp = o.policy
+}
+
+// The socket options below only take effect for senders created with New.
+
+type OptTTL struct {
+	ttl int
+}
+
+// TTL sets the TTL or hop limit of outgoing multicast packets.
+func TTL(ttl int) Opt {
+	return &OptTTL{
+		ttl: ttl,
+	}
+}
+
+func (o *OptTTL) apply(s *Sender) {
+	s.socket.TTL = o.ttl
+}
+
+type OptOrigin struct {
+	enabled bool
+}
+
+// Origin controls whether every transmission carries the sender's
+// identifier and a sequence number, which receivers use to drop copies that
+// arrive on redundant paths. It is enabled by default. Receivers that
+// predate it cannot parse such messages, so disable it while they are
+// still around.
+func Origin(enabled bool) Opt {
+	return &OptOrigin{
+		enabled: enabled,
+	}
+}
+
+func (o *OptOrigin) apply(s *Sender) {
+	s.origin = o.enabled
+}
+
+type OptLoopback struct {
+	enabled bool
+}
+
+// Loopback controls whether outgoing multicast packets are delivered to
+// sockets on the same host. It is enabled by default.
+func Loopback(enabled bool) Opt {
+	return &OptLoopback{
+		enabled: enabled,
+	}
+}
+
+func (o *OptLoopback) apply(s *Sender) {
+	s.socket.DisableLoopback = !o.enabled
+}
+
+type OptTOS struct {
+	tos int
+}
+
+// TOS sets the type of service or traffic class of outgoing packets.
+func TOS(tos int) Opt {
+	return &OptTOS{
+		tos: tos,
+	}
+}
+
+func (o *OptTOS) apply(s *Sender) {
+	s.socket.TOS = o.tos
+}
+
+type OptDSCP struct {
+	dscp int
+}
+
+// DSCP sets the differentiated services code point of outgoing packets.
+func DSCP(dscp int) Opt {
+	return &OptDSCP{
+		dscp: dscp,
+	}
+}
+
+func (o *OptDSCP) apply(s *Sender) {
+	s.socket.TOS = o.dscp << 2
+}
+
+type OptReceiveBuffer struct {
+	size int
+}
+
+// ReceiveBuffer sets the size of the socket receive buffers.
+func ReceiveBuffer(size int) Opt {
+	return &OptReceiveBuffer{
+		size: size,
+	}
+}
+
+func (o *OptReceiveBuffer) apply(s *Sender) {
+	s.socket.ReceiveBuffer = o.size
+}
+
+type OptSendBuffer struct {
+	size int
+}
+
+// SendBuffer sets the size of the socket send buffers.
+func SendBuffer(size int) Opt {
+	return &OptSendBuffer{
+		size: size,
+	}
+}
+
+func (o *OptSendBuffer) apply(s *Sender) {
+	s.socket.SendBuffer = o.size
+}
+
+type OptReusePort struct {
+	enabled bool
+}
+
+// ReusePort sets SO_REUSEPORT on the sockets, so that other processes can
+// bind the same ports.
+func ReusePort(enabled bool) Opt {
+	return &OptReusePort{
+		enabled: enabled,
+	}
+}
+
+func (o *OptReusePort) apply(s *Sender) {
+	s.socket.ReusePort = o.enabled
+}
+
+type OptInterfaceEvents struct {
+	cb func(udp.Event)
+}
+
+// InterfaceEvents sets a callback that is told about interfaces going down
+// and coming back. Sockets are reopened and groups rejoined automatically.
+func InterfaceEvents(cb func(udp.Event)) Opt {
+	return &OptInterfaceEvents{
+		cb: cb,
+	}
+}
+
+func (o *OptInterfaceEvents) apply(s *Sender) {
+	s.onInterfaceEvent = o.cb
+}
+
+type OptSelectInterfaces struct {
+	selector *ifselect.Selector
+}
+
+// SelectInterfaces picks the interfaces with a selector instead of a fixed
+// list, which must then be nil. The selection is updated whenever an
+// interface changes.
+func SelectInterfaces(sel *ifselect.Selector) Opt {
+	return &OptSelectInterfaces{
+		selector: sel,
+	}
+}
+
+func (o *OptSelectInterfaces) apply(s *Sender) {
+	s.selector = o.selector
+}
@@ -0,0 +1,52 @@
+package racket
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryPolicy controls how failed transmissions, including the first one,
+// are retried. After a failure, the message is sent again after Initial,
+// and the delay doubles with every further failure up to Max. Retries never
+// happen later than the regular resend, and a message stays queued no
+// matter how often sending it fails. The zero value disables retries, so
+// failed messages are only sent again at their interval.
+type RetryPolicy struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	Initial: 100 * time.Millisecond,
+	Max:     5 * time.Second,
+}
+
+func (p RetryPolicy) validate() error {
+	if p.Initial < 0 || p.Max < 0 || p.Max < p.Initial {
+		return fmt.Errorf("%w: retry policy %v-%v", ErrInvalidOption, p.Initial, p.Max)
+	}
+
+	return nil
+}
+
+// delay returns how long to wait before the given retry, counting from
+// zero, and false if the regular resend comes first.
+func (p RetryPolicy) delay(retry int, interval time.Duration) (time.Duration, bool) {
+	if p.Initial == 0 {
+		return 0, false
+	}
+
+	d := p.Initial
+
+	for range retry {
+		if d >= p.Max {
+			break
+		}
+
+		d *= 2
+	}
+
+	d = min(d, p.Max)
+
+	return d, d < interval
+}
@@ -2,135 +2,278 @@ package racket
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand/v2"
 	"net"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/holoplot/go-racket/pkg/ifselect"
 	"github.com/holoplot/go-racket/pkg/multicast"
-	"github.com/holoplot/go-racket/pkg/racket/global"
+	"github.com/holoplot/go-racket/pkg/racket/clock"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
 	"github.com/holoplot/go-racket/pkg/racket/stream"
-	"golang.org/x/net/ipv4"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+	"github.com/holoplot/go-racket/pkg/racket/transport/udp"
+)
+
+var (
+	ErrNoPool        = errors.New("no multicast pool")
+	ErrInvalidOption = errors.New("invalid option")
 )
 
 type Sender struct {
 	lock sync.RWMutex
 
-	ifis          []*net.Interface
-	pool          *multicastpool.Pool
+	id            uint64
+	origin        bool
+	transport     transport.Transport
+	ownTransport  bool
+	pools         []*multicastpool.Pool
+	socket        multicast.SocketOptions
+	clock         clock.Clock
+	logger        *slog.Logger
+	retry         RetryPolicy
+	catchUp       CatchUpPolicy
+	onSendError   func(*SendError)
 	senderStreams map[stream.Stream]*senderStream
+	control       []transport.Membership
+
+	selector         *ifselect.Selector
+	onInterfaceEvent func(udp.Event)
+
+	cancel context.CancelFunc
 }
 
 type queuedMessage struct {
 	msg    *message.Message
+	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Guarded by the lock of the stream
+	lastCatchUp time.Time
 }
 
 type senderStream struct {
-	lock     sync.RWMutex
-	sendLock sync.Mutex
-	pool     *multicastpool.Pool
-	pcs      []*ipv4.PacketConn
-	messages map[string]*queuedMessage
+	lock      sync.RWMutex
+	sendLock  sync.Mutex
+	publisher uint64
+	origin    bool
+	pools     []*multicastpool.Pool
+	transport transport.Transport
+	clock     clock.Clock
+	retry     RetryPolicy
+	catchUp   CatchUpPolicy
+	report    func(*SendError)
+	messages  map[string]*queuedMessage
+
+	// Patterns of the catch-up requests to answer
+	catchUpPatterns []subject.Subject
+
+	// Transmissions of the stream, so that receivers of one stream see
+	// consecutive sequence numbers however busy the others are
+	sequence atomic.Uint64
 
 	messagesSent atomic.Uint64
+	sendErrors   atomic.Uint64
 }
 
-func newSenderStream(ifis []*net.Interface, pool *multicastpool.Pool) (*senderStream, error) {
-	sg := &senderStream{
-		pool:     pool,
-		pcs:      make([]*ipv4.PacketConn, 0),
-		messages: make(map[string]*queuedMessage),
+func newSenderStream(s *Sender) *senderStream {
+	return &senderStream{
+		publisher: s.id,
+		origin:    s.origin,
+		pools:     s.pools,
+		transport: s.transport,
+		clock:     s.clock,
+		retry:     s.retry,
+		catchUp:   s.catchUp,
+		report:    s.reportSendError,
+		messages:  make(map[string]*queuedMessage),
 	}
+}
 
-	if err := sg.reopenPacketConns(ifis); err != nil {
-		return nil, err
+func (sg *senderStream) addresses(s stream.Stream) []*net.UDPAddr {
+	addrs := make([]*net.UDPAddr, 0, len(sg.pools))
+
+	for _, pool := range sg.pools {
+		addrs = append(addrs, pool.AddressForStream(s))
 	}
 
-	return sg, nil
+	return addrs
 }
 
-func (sg *senderStream) reopenPacketConns(ifis []*net.Interface) error {
-	sg.lock.Lock()
-	defer sg.lock.Unlock()
+// send transmits m to addrs unless ctx is done, which is checked under the
+// send lock so that nothing of a deleted message follows its tombstone.
+func (sg *senderStream) send(ctx context.Context, m *message.Message, addrs []*net.UDPAddr) error {
+	sg.sendLock.Lock()
+	defer sg.sendLock.Unlock()
 
-	for _, pc := range sg.pcs {
-		if err := pc.Close(); err != nil {
-			return err
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Every transmission gets a sequence number of its own, shared by the
+	// copies sent to all groups and interfaces. A zero origin is left out.
+	var origin message.Origin
+
+	if sg.origin {
+		origin = message.Origin{
+			Publisher: sg.publisher,
+			Sequence:  sg.sequence.Add(1),
 		}
 	}
 
-	pcs, err := multicast.OpenPacketConns(ifis, global.DefaultPort)
+	payload, err := m.MarshalBinaryWithOrigin(origin)
 	if err != nil {
-		return err
+		return &SendError{Stream: m.Stream, Subject: m.Subject, Err: err}
 	}
 
-	sg.pcs = pcs
+	var (
+		errs []error
+		sent bool
+	)
 
-	return nil
-}
+	// A failure on one group does not keep the message from the others.
+	for _, addr := range addrs {
+		err := sg.transport.Send(payload, addr)
 
-func (sg *senderStream) send(m *message.Message, addr *net.UDPAddr) error {
-	sg.sendLock.Lock()
-	defer sg.sendLock.Unlock()
+		var pe *transport.PartialError
+		if err == nil || errors.As(err, &pe) {
+			sent = true
+		}
 
-	for _, pc := range sg.pcs {
-		if err := m.Send(pc, addr); err != nil {
-			return err
+		if err != nil {
+			errs = append(errs, newSendErrors(m.Stream, m.Subject, addr, err)...)
 		}
 	}
 
-	sg.messagesSent.Add(1)
+	if sent {
+		sg.messagesSent.Add(1)
+	}
 
-	return nil
+	if len(errs) == 0 {
+		return nil
+	}
+
+	sg.sendErrors.Add(1)
+
+	if sent {
+		return &transport.PartialError{Err: errors.Join(errs...)}
+	}
+
+	return errors.Join(errs...)
 }
 
-func (sg *senderStream) publish(m *message.Message) {
+func (sg *senderStream) publish(m *message.Message) error {
 	ctx, cancel := context.WithCancel(context.TODO())
 
+	qm := &queuedMessage{
+		msg:    m,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
 	sg.lock.Lock()
 
-	if qm, ok := sg.messages[m.Subject.String()]; ok {
-		qm.cancel()
+	if old, ok := sg.messages[m.Subject.String()]; ok {
+		old.cancel()
 	}
 
-	sg.messages[m.Subject.String()] = &queuedMessage{
-		msg:    m,
-		cancel: cancel,
-	}
+	sg.messages[m.Subject.String()] = qm
 
 	sg.lock.Unlock()
 
-	go func() {
-		addr := sg.pool.AddressForStream(m.Stream)
+	addrs := sg.addresses(m.Stream)
 
-		// Send the message immediately
-		if err := sg.send(m, addr); err != nil {
-			fmt.Printf("Error sending message: %v\n", err)
-			return
+	// Send the message immediately. It stays queued even if that failed,
+	// and the resend loop retries it.
+	err := sg.send(ctx, m, addrs)
+	if ctx.Err() != nil {
+		// A newer value or a tombstone took its place in the meantime.
+		return nil
+	}
+
+	// The ticker exists once Publish returns, so that a fake clock can be
+	// advanced right away.
+	go sg.resend(ctx, m, addrs, sg.clock.NewTicker(m.Interval), err)
+
+	// Receivers got the message if a copy went out on any group or
+	// interface, so the others are only reported.
+	var pe *transport.PartialError
+	if errors.As(err, &pe) {
+		for _, e := range sendErrors(err) {
+			sg.report(e)
 		}
 
-		ticker := time.NewTicker(m.Interval)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				if err := sg.send(m, addr); err != nil {
-					if ctx.Err() != nil {
-						return
-					}
-
-					fmt.Printf("Error sending message: %v\n", err)
-				}
-			}
+		return nil
+	}
+
+	return err
+}
+
+// resend sends m whenever ticker fires until ctx is done. Failures, starting
+// with err of the first transmission, are retried according to the retry
+// policy, and those of resends are reported.
+func (sg *senderStream) resend(ctx context.Context, m *message.Message, addrs []*net.UDPAddr, ticker clock.Ticker, err error) {
+	defer ticker.Stop()
+
+	var (
+		retry  clock.Timer
+		retryC <-chan time.Time
+	)
+
+	defer func() {
+		if retry != nil {
+			retry.Stop()
 		}
 	}()
+
+	retries := 0
+
+	for {
+		switch d, ok := sg.retry.delay(retries, m.Interval); {
+		case err == nil:
+			if retry != nil {
+				retry.Stop()
+				retryC = nil
+			}
+
+			retries = 0
+		case !ok:
+			retryC = nil
+		default:
+			retries++
+
+			if retry == nil {
+				retry = sg.clock.NewTimer(d)
+			} else {
+				retry.Reset(d)
+			}
+
+			retryC = retry.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		case <-retryC:
+		}
+
+		err = sg.send(ctx, m, addrs)
+		if ctx.Err() != nil {
+			return
+		}
+
+		for _, e := range sendErrors(err) {
+			sg.report(e)
+		}
+	}
 }
 
 func (sg *senderStream) flush() {
@@ -141,21 +284,129 @@ func (sg *senderStream) flush() {
 		qm.cancel()
 	}
 
-	for _, pc := range sg.pcs {
-		pc.Close()
+	sg.messages = make(map[string]*queuedMessage)
+}
+
+// New creates a sender that publishes via UDP multicast on the given
+// interfaces.
+func New(ifis []*net.Interface, pool *multicastpool.Pool, opts ...Opt) (*Sender, error) {
+	s, err := newSender(pool, opts...)
+	if err != nil {
+		return nil, err
 	}
 
-	sg.messages = make(map[string]*queuedMessage)
+	if s.selector != nil {
+		if len(ifis) > 0 {
+			return nil, fmt.Errorf("%w: interfaces given along with a selector", ErrInvalidOption)
+		}
+
+		if ifis, err = s.selector.Select(); err != nil {
+			return nil, err
+		}
+	}
+
+	t := udp.New(ifis,
+		udp.Socket(s.socket),
+		udp.Logger(s.logger),
+		udp.Selector(s.selector),
+		udp.OnEvent(s.onInterfaceEvent))
+
+	for _, pool := range s.pools {
+		if err := t.Open(pool.Network()); err != nil {
+			t.Close()
+			return nil, fmt.Errorf("failed to open sockets: %w", err)
+		}
+	}
+
+	s.transport = t
+	s.ownTransport = true
+
+	if err := s.start(); err != nil {
+		t.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// NewWithTransport creates a sender that publishes via the given transport.
+// The transport is not closed when the sender is closed.
+func NewWithTransport(t transport.Transport, pool *multicastpool.Pool, opts ...Opt) (*Sender, error) {
+	s, err := newSender(pool, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	s.transport = t
+
+	if err := s.start(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
 }
 
-func New(ifis []*net.Interface, pool *multicastpool.Pool) (*Sender, error) {
-	sender := &Sender{
+func newSender(pool *multicastpool.Pool, opts ...Opt) (*Sender, error) {
+	if pool == nil {
+		return nil, ErrNoPool
+	}
+
+	s := &Sender{
 		senderStreams: make(map[stream.Stream]*senderStream),
-		ifis:          ifis,
-		pool:          pool,
+		id:            rand.Uint64(),
+		origin:        true,
+		pools:         []*multicastpool.Pool{pool},
+		clock:         clock.Real,
+		logger:        slog.Default(),
+		retry:         DefaultRetryPolicy,
+		catchUp:       DefaultCatchUpPolicy,
+	}
+
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+
+	if s.clock == nil {
+		return nil, fmt.Errorf("%w: no clock", ErrInvalidOption)
+	}
+
+	if s.logger == nil {
+		return nil, fmt.Errorf("%w: no logger", ErrInvalidOption)
+	}
+
+	if err := s.socket.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOption, err)
+	}
+
+	if err := s.retry.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.catchUp.validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Sender) start() error {
+	if s.catchUp.enabled() {
+		if err := s.joinControl(); err != nil {
+			return err
+		}
 	}
 
-	return sender, nil
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+
+	go s.announce(ctx)
+
+	return nil
+}
+
+// ID returns the random identifier this sender announces itself with.
+func (s *Sender) ID() uint64 {
+	return s.id
 }
 
 func (s *Sender) Publish(m *message.Message) error {
@@ -167,48 +418,75 @@ func (s *Sender) Publish(m *message.Message) error {
 		return fmt.Errorf("wildcard in subject not allowed")
 	}
 
+	m.Stamp(s.clock.Now())
+
 	s.lock.Lock()
 
 	sg := s.senderStreams[m.Stream]
 	if sg == nil {
-		var err error
-
-		sg, err = newSenderStream(s.ifis, s.pool)
-		if err != nil {
-			s.lock.Unlock()
-			return err
-		}
-
+		sg = newSenderStream(s)
 		s.senderStreams[m.Stream] = sg
 	}
 
 	s.lock.Unlock()
 
-	sg.publish(m)
+	if err := sg.publish(m); err != nil {
+		return fmt.Errorf("failed to send message to stream %s: %w", m.Stream, err)
+	}
 
 	return nil
 }
 
+// Delete stops resending the message and sends a tombstone in its place,
+// which tells receivers that the subject is gone. Receivers that miss the
+// tombstone notice once the subject goes stale.
 func (s *Sender) Delete(m *message.Message) error {
 	s.lock.Lock()
-	defer s.lock.Unlock()
 
 	sg := s.senderStreams[m.Stream]
 	if sg == nil {
+		s.lock.Unlock()
 		return fmt.Errorf("stream %s not found", m.Stream)
 	}
 
+	s.lock.Unlock()
+
 	sg.lock.Lock()
-	defer sg.lock.Unlock()
 
 	qm, ok := sg.messages[m.Subject.String()]
 	if !ok {
+		sg.lock.Unlock()
 		return fmt.Errorf("message not found in stream %s", m.Stream)
 	}
 
 	qm.cancel()
 	delete(sg.messages, m.Subject.String())
 
+	sg.lock.Unlock()
+
+	tombstone := &message.Message{
+		Stream:    m.Stream,
+		Subject:   m.Subject,
+		Tombstone: true,
+	}
+
+	tombstone.Stamp(s.clock.Now())
+
+	err := sg.send(context.Background(), tombstone, sg.addresses(m.Stream))
+
+	var pe *transport.PartialError
+	if errors.As(err, &pe) {
+		for _, e := range sendErrors(err) {
+			sg.report(e)
+		}
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to send tombstone to stream %s: %w", m.Stream, err)
+	}
+
 	return nil
 }
 
@@ -223,12 +501,27 @@ func (s *Sender) Flush() {
 	s.senderStreams = make(map[stream.Stream]*senderStream)
 }
 
+func (s *Sender) Close() {
+	s.Flush()
+
+	s.cancel()
+
+	for _, m := range s.control {
+		m.Close()
+	}
+
+	if s.ownTransport {
+		s.transport.Close()
+	}
+}
+
 type StreamStats struct {
 	QueuedMessages    int     `json:"queued_messages,omitempty"`
 	QueuedBytes       int     `json:"queued_bytes,omitempty"`
 	MessagesPerSecond float64 `json:"messages_per_second,omitempty"`
 	BytesPerSecond    float64 `json:"bytes_per_second,omitempty"`
 	MessagesSent      uint64  `json:"messages_sent,omitempty"`
+	SendErrors        uint64  `json:"send_errors,omitempty"`
 }
 
 type Stats struct {
@@ -246,6 +539,7 @@ func (s *Sender) Stats() Stats {
 	for stream, sg := range s.senderStreams {
 		streamStats := StreamStats{
 			MessagesSent: sg.messagesSent.Load(),
+			SendErrors:   sg.sendErrors.Load(),
 		}
 
 		sg.lock.RLock()
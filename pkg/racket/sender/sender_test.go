@@ -0,0 +1,708 @@
+package racket
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	"github.com/holoplot/go-racket/pkg/racket/stream"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+	"github.com/holoplot/go-racket/pkg/racket/transport/memory"
+)
+
+func newTestSender(t *testing.T) (*Sender, *memory.Bus, *multicastpool.Pool) {
+	t.Helper()
+
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	bus := memory.NewBus()
+
+	s, err := NewWithTransport(bus.NewTransport(), pool)
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	return s, bus, pool
+}
+
+func TestNewWithTransport_NoPool(t *testing.T) {
+	bus := memory.NewBus()
+
+	if _, err := NewWithTransport(bus.NewTransport(), nil); err == nil {
+		t.Error("expected error without pool, got nil")
+	}
+}
+
+func TestSender_Publish(t *testing.T) {
+	s, bus, pool := newTestSender(t)
+
+	received := make(chan *message.Message, 16)
+
+	addr := pool.AddressForStream("stream-1")
+	if _, err := bus.NewTransport().Join(addr, func(payload []byte, _ net.Addr, _ string) {
+		msg, err := message.Parse(payload)
+		if err != nil {
+			t.Errorf("failed to parse message: %v", err)
+			return
+		}
+
+		received <- msg
+	}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Data:     []byte("foo"),
+		Interval: 10 * time.Millisecond,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	for range 3 {
+		select {
+		case msg := <-received:
+			if msg.Subject.String() != "org.foo.bar" || string(msg.Data) != "foo" {
+				t.Fatalf("unexpected message %s: %q", msg.Subject, msg.Data)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for message")
+		}
+	}
+
+	stats := s.Stats().Streams["stream-1"]
+	if stats.QueuedMessages != 1 || stats.MessagesSent < 3 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if err := s.Delete(&message.Message{Stream: "stream-1", Subject: su}); err != nil {
+		t.Fatalf("failed to delete: %v", err)
+	}
+
+	if stats := s.Stats().Streams["stream-1"]; stats.QueuedMessages != 0 {
+		t.Errorf("expected no queued messages after delete, got %d", stats.QueuedMessages)
+	}
+}
+
+func TestSender_Origin(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	for _, enabled := range []bool{true, false} {
+		bus := memory.NewBus()
+
+		s, err := NewWithTransport(bus.NewTransport(), pool, Origin(enabled))
+		if err != nil {
+			t.Fatalf("failed to create sender: %v", err)
+		}
+
+		t.Cleanup(s.Close)
+
+		received := make(chan *message.Message, 16)
+
+		if _, err := bus.NewTransport().Join(pool.AddressForStream("stream-1"), func(payload []byte, _ net.Addr, _ string) {
+			if msg, err := message.Parse(payload); err == nil {
+				received <- msg
+			}
+		}); err != nil {
+			t.Fatalf("failed to join: %v", err)
+		}
+
+		if err := s.Publish(&message.Message{
+			Stream:   "stream-1",
+			Subject:  su,
+			Interval: time.Hour,
+		}); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+
+		select {
+		case msg := <-received:
+			if expected := (message.Origin{Publisher: s.ID(), Sequence: 1}); enabled && msg.Origin != expected {
+				t.Errorf("expected origin %+v, got %+v", expected, msg.Origin)
+			}
+
+			if !enabled && msg.Origin != (message.Origin{}) {
+				t.Errorf("expected no origin, got %+v", msg.Origin)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+	}
+}
+
+func TestSender_OriginPerStream(t *testing.T) {
+	s, bus, pool := newTestSender(t)
+
+	received := make(chan *message.Message, 16)
+
+	if _, err := bus.NewTransport().Join(pool.AddressForStream("stream-1"), func(payload []byte, _ net.Addr, _ string) {
+		if msg, err := message.Parse(payload); err == nil && msg.Stream == "stream-1" {
+			received <- msg
+		}
+	}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	for _, st := range []stream.Stream{"stream-2", "stream-2", "stream-2", "stream-1"} {
+		if err := s.Publish(&message.Message{
+			Stream:   st,
+			Subject:  su,
+			Interval: time.Hour,
+		}); err != nil {
+			t.Fatalf("failed to publish: %v", err)
+		}
+	}
+
+	// Transmissions of other streams do not take sequence numbers.
+	select {
+	case msg := <-received:
+		if expected := (message.Origin{Publisher: s.ID(), Sequence: 1}); msg.Origin != expected {
+			t.Errorf("expected origin %+v, got %+v", expected, msg.Origin)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+}
+
+func TestSender_PublishWildcard(t *testing.T) {
+	s, _, _ := newTestSender(t)
+
+	su, _ := subject.Parse("org.foo.*")
+
+	if err := s.Publish(&message.Message{Stream: "stream-1", Subject: su, Interval: time.Second}); err == nil {
+		t.Error("expected error for wildcard subject, got nil")
+	}
+}
+
+func TestSender_Clock(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	bus := memory.NewBus()
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	s, err := NewWithTransport(bus.NewTransport(), pool, Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	received := make(chan *message.Message, 16)
+
+	if _, err := bus.NewTransport().Join(pool.AddressForStream("stream-1"), func(payload []byte, _ net.Addr, _ string) {
+		msg, err := message.Parse(payload)
+		if err != nil {
+			t.Errorf("failed to parse message: %v", err)
+			return
+		}
+
+		received <- msg
+	}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Minute,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	msg := <-received
+	if !msg.TimeStamp().Equal(c.Now()) {
+		t.Errorf("expected timestamp %v, got %v", c.Now(), msg.TimeStamp())
+	}
+
+	// Wait for the tickers of the announcements and the resend.
+	c.BlockUntil(2)
+
+	for i := range 3 {
+		select {
+		case <-received:
+			t.Fatal("message resent before its interval")
+		default:
+		}
+
+		c.Advance(time.Minute)
+
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("message not resent after %d intervals", i+1)
+		}
+	}
+}
+
+var errSend = errors.New("send failed")
+
+type failingTransport struct {
+	*memory.Transport
+}
+
+func (failingTransport) Send([]byte, *net.UDPAddr) error {
+	return errSend
+}
+
+func TestSender_PublishError(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	s, err := NewWithTransport(failingTransport{memory.NewBus().NewTransport()}, pool)
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	err = s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Second,
+	})
+	if !errors.Is(err, errSend) {
+		t.Fatalf("expected send error, got %v", err)
+	}
+
+	// The failed message stays queued to be retried.
+	if n := s.Stats().Streams["stream-1"].QueuedMessages; n != 1 {
+		t.Errorf("expected failed message to stay queued, got %d", n)
+	}
+}
+
+// partialTransport delivers packets, but reports a failure on a second
+// interface.
+type partialTransport struct {
+	*memory.Transport
+}
+
+func (t partialTransport) Send(payload []byte, group *net.UDPAddr) error {
+	if err := t.Transport.Send(payload, group); err != nil {
+		return err
+	}
+
+	return &transport.PartialError{
+		Err: errors.Join(&transport.InterfaceError{Interface: "eth1", Err: syscall.ENETUNREACH}),
+	}
+}
+
+func TestSender_PublishPartialError(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	bus := memory.NewBus()
+	c := clock.NewFake(time.Now())
+
+	s, err := NewWithTransport(partialTransport{bus.NewTransport()}, pool, Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	sendErrors := make(chan *SendError, 16)
+	s.OnSendError(func(e *SendError) {
+		sendErrors <- e
+	})
+
+	received := make(chan string, 16)
+
+	if _, err := bus.NewTransport().Join(pool.AddressForStream("stream-1"), func(payload []byte, _ net.Addr, _ string) {
+		if m, err := message.Parse(payload); err == nil {
+			received <- string(m.Data)
+		}
+	}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	for _, data := range []string{"v1", "v2"} {
+		if err := s.Publish(&message.Message{
+			Stream:   "stream-1",
+			Subject:  su,
+			Data:     []byte(data),
+			Interval: time.Minute,
+		}); err != nil {
+			t.Fatalf("expected partial failure not to fail publish, got %v", err)
+		}
+
+		if got := <-received; got != data {
+			t.Errorf("expected %s, got %s", data, got)
+		}
+
+		select {
+		case e := <-sendErrors:
+			if e.Interface != "eth1" || !errors.Is(e, syscall.ENETUNREACH) {
+				t.Errorf("unexpected send error %+v", e)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("partial failure not reported")
+		}
+	}
+
+	if n := s.Stats().Streams["stream-1"].QueuedMessages; n != 1 {
+		t.Fatalf("expected the new value to replace the old one, got %d queued", n)
+	}
+
+	// The failed interface is retried with the latest value, once the
+	// resend loop has armed its timer.
+	timeout := time.After(time.Second)
+
+	for {
+		c.Advance(DefaultRetryPolicy.Initial)
+
+		select {
+		case got := <-received:
+			if got != "v2" {
+				t.Errorf("expected v2 to be retried, got %s", got)
+			}
+
+			return
+		case <-timeout:
+			t.Fatal("message not retried")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestNewWithTransport_InvalidOptions(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	for _, opt := range []Opt{
+		TTL(256),
+		DSCP(64),
+		TOS(-1),
+		ReceiveBuffer(-1),
+		SendBuffer(-1),
+		CatchUp(CatchUpPolicy{Jitter: -1, MinInterval: time.Second}),
+		Clock(nil),
+		Logger(nil),
+	} {
+		if _, err := NewWithTransport(memory.NewBus().NewTransport(), pool, opt); !errors.Is(err, ErrInvalidOption) {
+			t.Errorf("expected invalid option error for %+v, got %v", opt, err)
+		}
+	}
+}
+
+type flakyTransport struct {
+	*memory.Transport
+	failing atomic.Bool
+}
+
+func (t *flakyTransport) Send(payload []byte, group *net.UDPAddr) error {
+	if t.failing.Load() {
+		return errors.Join(&transport.InterfaceError{Interface: "eth0", Err: syscall.ENETUNREACH})
+	}
+
+	return t.Transport.Send(payload, group)
+}
+
+// recordingTransport keeps the messages it sends.
+type recordingTransport struct {
+	*memory.Transport
+
+	mutex    sync.Mutex
+	messages []*message.Message
+}
+
+func (t *recordingTransport) Send(payload []byte, group *net.UDPAddr) error {
+	msg, err := message.Parse(payload)
+	if err != nil {
+		return err
+	}
+
+	t.mutex.Lock()
+	t.messages = append(t.messages, msg)
+	t.mutex.Unlock()
+
+	return t.Transport.Send(payload, group)
+}
+
+func (t *recordingTransport) sent() []*message.Message {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return slices.Clone(t.messages)
+}
+
+type syncBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.buf.String()
+}
+
+func TestSender_PublishDeleteRace(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	tr := &recordingTransport{Transport: memory.NewBus().NewTransport()}
+
+	s, err := NewWithTransport(tr, pool)
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	other, _ := subject.Parse("org.foo.other")
+	su, _ := subject.Parse("org.foo.bar")
+
+	if err := s.Publish(&message.Message{Stream: "stream-1", Subject: other, Interval: time.Hour}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	queued := func(n int) {
+		t.Helper()
+
+		for s.Stats().Streams["stream-1"].QueuedMessages != n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// Hold the send lock, so that the value is queued but not sent yet
+	// when it is deleted.
+	s.lock.Lock()
+	sg := s.senderStreams["stream-1"]
+	s.lock.Unlock()
+
+	sg.sendLock.Lock()
+
+	published := make(chan error, 1)
+	deleted := make(chan error, 1)
+
+	go func() {
+		published <- s.Publish(&message.Message{Stream: "stream-1", Subject: su, Data: []byte("foo"), Interval: time.Hour})
+	}()
+
+	queued(2)
+
+	go func() {
+		deleted <- s.Delete(&message.Message{Stream: "stream-1", Subject: su})
+	}()
+
+	queued(1)
+
+	sg.sendLock.Unlock()
+
+	if err := <-published; err != nil {
+		t.Errorf("failed to publish: %v", err)
+	}
+
+	if err := <-deleted; err != nil {
+		t.Errorf("failed to delete: %v", err)
+	}
+
+	for _, msg := range tr.sent() {
+		if msg.Subject.String() == su.String() && !msg.Tombstone {
+			t.Errorf("expected the deleted value not to be sent, got %q", msg.Data)
+		}
+	}
+}
+
+func TestSender_Logger(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	c := clock.NewFake(time.Now())
+	tr := &flakyTransport{Transport: memory.NewBus().NewTransport()}
+
+	var logs syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	s, err := NewWithTransport(tr, pool, Clock(c), Logger(logger))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Second,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	c.BlockUntil(2)
+	tr.failing.Store(true)
+	c.Advance(time.Second)
+
+	deadline := time.Now().Add(time.Second)
+
+	for !strings.Contains(logs.String(), `"msg":"failed to send message"`) {
+		if time.Now().After(deadline) {
+			t.Fatalf("send failure not logged: %s", logs.String())
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	for _, field := range []string{`"stream":"stream-1"`, `"subject":"org.foo.bar"`, `"error":`} {
+		if !strings.Contains(logs.String(), field) {
+			t.Errorf("expected %s in log output: %s", field, logs.String())
+		}
+	}
+}
+
+func TestSender_OnSendError(t *testing.T) {
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	bus := memory.NewBus()
+	c := clock.NewFake(time.Now())
+	tr := &flakyTransport{Transport: bus.NewTransport()}
+
+	s, err := NewWithTransport(tr, pool, Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	sendErrors := make(chan *SendError, 16)
+	s.OnSendError(func(e *SendError) {
+		sendErrors <- e
+	})
+
+	received := make(chan struct{}, 16)
+
+	if _, err := bus.NewTransport().Join(pool.AddressForStream("stream-1"), func([]byte, net.Addr, string) {
+		received <- struct{}{}
+	}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	su, _ := subject.Parse("org.foo.bar")
+
+	if err := s.Publish(&message.Message{
+		Stream:   "stream-1",
+		Subject:  su,
+		Interval: time.Minute,
+	}); err != nil {
+		t.Fatalf("failed to publish: %v", err)
+	}
+
+	<-received
+
+	c.BlockUntil(2)
+	tr.failing.Store(true)
+	c.Advance(time.Minute)
+
+	select {
+	case e := <-sendErrors:
+		if e.Stream != "stream-1" || e.Subject.String() != "org.foo.bar" || e.Interface != "eth0" {
+			t.Errorf("unexpected send error %+v", e)
+		}
+
+		if !errors.Is(e, syscall.ENETUNREACH) {
+			t.Errorf("expected ENETUNREACH, got %v", e.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("send error not reported")
+	}
+
+	// The retry timer is armed in addition to the tickers.
+	c.BlockUntil(3)
+	tr.failing.Store(false)
+	c.Advance(DefaultRetryPolicy.Initial)
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("message not retried")
+	}
+
+	stats := s.Stats().Streams["stream-1"]
+	if stats.SendErrors != 1 || stats.QueuedMessages != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{Initial: time.Second, Max: 5 * time.Second}
+
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		d, ok := p.delay(i, time.Minute)
+		if !ok || d != expected {
+			t.Errorf("retry %d: expected %v, got %v (%v)", i, expected, d, ok)
+		}
+	}
+
+	if _, ok := p.delay(2, 3*time.Second); ok {
+		t.Error("expected no retry after the interval")
+	}
+
+	if _, ok := (RetryPolicy{}).delay(0, time.Minute); ok {
+		t.Error("expected zero policy to disable retries")
+	}
+
+	_, _, pool := newTestSender(t)
+
+	if _, err := NewWithTransport(memory.NewBus().NewTransport(), pool, Retry(RetryPolicy{Initial: time.Second})); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected invalid retry policy to be rejected, got %v", err)
+	}
+}
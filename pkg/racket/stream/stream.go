@@ -1,3 +1,51 @@
 package stream
 
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmpty            = errors.New("stream is empty")
+	ErrInvalidCharacter = errors.New("stream contains invalid character")
+)
+
 type Stream string
+
+func (s Stream) String() string {
+	return string(s)
+}
+
+func (s Stream) Validate() error {
+	if s == "" {
+		return ErrEmpty
+	}
+
+	// The wire format uses a backslash sequence as field separator.
+	if strings.ContainsAny(string(s), "\\\x00") {
+		return ErrInvalidCharacter
+	}
+
+	return nil
+}
+
+func (s Stream) MarshalText() ([]byte, error) {
+	return []byte(s), nil
+}
+
+func (s *Stream) UnmarshalText(text []byte) error {
+	parsed := Stream(text)
+
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+
+	*s = parsed
+
+	return nil
+}
+
+// Set implements flag.Value.
+func (s *Stream) Set(value string) error {
+	return s.UnmarshalText([]byte(value))
+}
@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUnmarshalText(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectError bool
+	}{
+		{"stream-1", false},
+		{"", true},
+		{"foo\\0bar", true},
+	}
+
+	for _, test := range tests {
+		var s Stream
+
+		err := s.UnmarshalText([]byte(test.input))
+		if test.expectError {
+			if err == nil {
+				t.Errorf("expected error for input %q, got nil", test.input)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", test.input, err)
+		}
+
+		if s.String() != test.input {
+			t.Errorf("expected %q, got %q", test.input, s)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var streams []Stream
+
+	if err := json.Unmarshal([]byte(`["a","b"]`), &streams); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(streams) != 2 || streams[0] != "a" || streams[1] != "b" {
+		t.Errorf("unexpected result %v", streams)
+	}
+
+	if err := json.Unmarshal([]byte(`["a",""]`), &streams); err == nil {
+		t.Error("expected error for empty stream, got nil")
+	}
+}
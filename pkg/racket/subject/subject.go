@@ -2,6 +2,7 @@ package subject
 
 import (
 	"errors"
+	"slices"
 	"strings"
 )
 
@@ -16,6 +17,8 @@ type Subject struct {
 
 var (
 	ErrWildcardNotLast = errors.New("wildcard not at the end of subject")
+	ErrEmpty           = errors.New("subject is empty")
+	ErrEmptyPart       = errors.New("subject contains an empty part")
 )
 
 func Parse(subject string) (Subject, error) {
@@ -38,6 +41,66 @@ func (s Subject) HasWildcard() bool {
 	return s.Parts[len(s.Parts)-1] == Wildcard
 }
 
+// Matches reports whether a subscription to s receives messages of subject
+// other. As with subscriptions, s matches all subjects it is a prefix of,
+// and a trailing wildcard is ignored.
+func (s Subject) Matches(other Subject) bool {
+	parts := s.Parts
+	if len(parts) > 0 && parts[len(parts)-1] == Wildcard {
+		parts = parts[:len(parts)-1]
+	}
+
+	if len(parts) > len(other.Parts) {
+		return false
+	}
+
+	return slices.Equal(parts, other.Parts[:len(parts)])
+}
+
 func (s Subject) String() string {
 	return strings.Join(s.Parts, Separator)
 }
+
+// Validate checks the subject for properties that Parse is lenient about,
+// such as empty parts.
+func (s Subject) Validate() error {
+	if len(s.Parts) == 0 || s.String() == "" {
+		return ErrEmpty
+	}
+
+	for i, part := range s.Parts {
+		if part == "" {
+			return ErrEmptyPart
+		}
+
+		if part == Wildcard && i != len(s.Parts)-1 {
+			return ErrWildcardNotLast
+		}
+	}
+
+	return nil
+}
+
+func (s Subject) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Subject) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	if err := parsed.Validate(); err != nil {
+		return err
+	}
+
+	*s = parsed
+
+	return nil
+}
+
+// Set implements flag.Value.
+func (s *Subject) Set(value string) error {
+	return s.UnmarshalText([]byte(value))
+}
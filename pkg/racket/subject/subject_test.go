@@ -1,6 +1,9 @@
 package subject
 
 import (
+	"encoding/json"
+	"flag"
+	"io"
 	"testing"
 )
 
@@ -78,3 +81,116 @@ func TestString(t *testing.T) {
 		}
 	}
 }
+
+func TestUnmarshalText(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    string
+		expectError bool
+	}{
+		{"a.b.c", "a.b.c", false},
+		{"a.b.*", "a.b.*", false},
+		{"*", "*", false},
+		{"a.*.c", "", true},
+		{"", "", true},
+		{"a..c", "", true},
+		{"a.b.", "", true},
+	}
+
+	for _, test := range tests {
+		var s Subject
+
+		err := s.UnmarshalText([]byte(test.input))
+		if test.expectError {
+			if err == nil {
+				t.Errorf("expected error for input %q, got nil", test.input)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("unexpected error for input %q: %v", test.input, err)
+		}
+
+		if s.String() != test.expected {
+			t.Errorf("expected %q, got %q", test.expected, s.String())
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	type config struct {
+		Subject Subject `json:"subject"`
+	}
+
+	in := config{Subject: Subject{Parts: []string{"org", "foo", "*"}}}
+
+	b, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	if string(b) != `{"subject":"org.foo.*"}` {
+		t.Errorf("unexpected JSON %s", b)
+	}
+
+	var out config
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if out.Subject.String() != in.Subject.String() {
+		t.Errorf("expected %q, got %q", in.Subject, out.Subject)
+	}
+
+	if err := json.Unmarshal([]byte(`{"subject":"org.*.foo"}`), &out); err == nil {
+		t.Error("expected error for invalid subject, got nil")
+	}
+}
+
+func TestFlag(t *testing.T) {
+	var s Subject
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&s, "subject", "subject")
+
+	if err := fs.Parse([]string{"-subject", "org.foo.bar"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if s.String() != "org.foo.bar" {
+		t.Errorf("expected %q, got %q", "org.foo.bar", s)
+	}
+
+	if err := fs.Parse([]string{"-subject", "org..bar"}); err == nil {
+		t.Error("expected error for invalid subject, got nil")
+	}
+}
+
+func TestSubject_Matches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		subject string
+		want    bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.b.c", true},
+		{"a.b", "a.c", false},
+		{"a.b.c", "a.b", false},
+		{"a.*", "a.b.c", true},
+		{"a.*", "a", true},
+		{"a.*", "b.a", false},
+		{"*", "a.b", true},
+	}
+
+	for _, test := range tests {
+		p, _ := Parse(test.pattern)
+		s, _ := Parse(test.subject)
+
+		if got := p.Matches(s); got != test.want {
+			t.Errorf("%q matching %q: expected %v, got %v", test.pattern, test.subject, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package subscription
+
+import (
+	"container/list"
+	"slices"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/message"
+)
+
+const (
+	// DefaultChangeCacheSize is the number of subjects per tree whose
+	// values are remembered for OnlyOnChange subscriptions.
+	DefaultChangeCacheSize = 65536
+
+	// A subject is forgotten when it was not seen for this many of its
+	// intervals, but not before minChangeTTL. Until its interval is known,
+	// which takes a second message, defaultChangeTTL applies.
+	changeTTLIntervals = 3
+	minChangeTTL       = 10 * time.Second
+	defaultChangeTTL   = time.Minute
+
+	// The interval of a subject is the longest of this many recent gaps
+	// between its messages.
+	changeGaps = 4
+)
+
+type changeEntry struct {
+	subject  string
+	hash     string
+	last     *message.Message
+	lastSeen time.Time
+	interval time.Duration
+	gaps     [changeGaps]time.Duration
+	gap      int
+	seen     map[*Subscription]struct{}
+	element  *list.Element
+}
+
+// observe records the gap since the previous message. Catch-up answers and
+// redundant senders shorten single gaps, so the longest recent one is taken
+// as the interval. Older gaps are forgotten, so that the interval follows
+// changes and a long gap, such as during an outage, does not stick.
+func (e *changeEntry) observe(gap time.Duration) {
+	e.gaps[e.gap%changeGaps] = gap
+	e.gap++
+	e.interval = slices.Max(e.gaps[:])
+}
+
+func (e *changeEntry) ttl() time.Duration {
+	if e.interval == 0 {
+		return defaultChangeTTL
+	}
+
+	return max(changeTTLIntervals*e.interval, minChangeTTL)
+}
+
+// changeCache remembers the current value of each subject in a tree, and
+// which OnlyOnChange subscriptions have seen it. Subjects are evicted when
+// they were not seen for a few of their intervals, when the cache is full,
+// and on tombstones. A forgotten subject is delivered again the next time
+// it is seen. It is guarded by the lock of the tree.
+type changeCache struct {
+	size      int
+	entries   map[string]*changeEntry
+	lru       *list.List
+	lastSweep time.Time
+}
+
+func newChangeCache(size int) *changeCache {
+	return &changeCache{
+		size:    size,
+		entries: make(map[string]*changeEntry),
+		lru:     list.New(),
+	}
+}
+
+// changed reports whether msg carries a value sub has not seen yet, and
+// records that it has.
+func (c *changeCache) changed(sub *Subscription, msg *message.Message, now time.Time) bool {
+	k := msg.Subject.String()
+
+	c.expire(now)
+
+	if msg.Tombstone {
+		c.remove(k)
+		return true
+	}
+
+	e, ok := c.entries[k]
+	switch {
+	case !ok:
+		e = &changeEntry{
+			subject:  k,
+			lastSeen: now,
+			seen:     make(map[*Subscription]struct{}),
+		}
+		e.element = c.lru.PushBack(e)
+		c.entries[k] = e
+
+		for c.lru.Len() > c.size {
+			c.remove(c.lru.Front().Value.(*changeEntry).subject)
+		}
+
+	case e.last != msg:
+		e.observe(now.Sub(e.lastSeen))
+		e.lastSeen = now
+		c.lru.MoveToBack(e.element)
+	}
+
+	e.last = msg
+
+	if h := msg.Hash(); e.hash != h {
+		e.hash = h
+		clear(e.seen)
+	}
+
+	if _, ok := e.seen[sub]; ok {
+		return false
+	}
+
+	e.seen[sub] = struct{}{}
+
+	return true
+}
+
+// expire evicts the least recently seen subjects that have expired, and
+// all others once per defaultChangeTTL.
+func (c *changeCache) expire(now time.Time) {
+	for c.lru.Len() > 0 {
+		e := c.lru.Front().Value.(*changeEntry)
+		if now.Sub(e.lastSeen) <= e.ttl() {
+			break
+		}
+
+		c.remove(e.subject)
+	}
+
+	if now.Sub(c.lastSweep) < defaultChangeTTL {
+		return
+	}
+
+	c.lastSweep = now
+
+	for k, e := range c.entries {
+		if now.Sub(e.lastSeen) > e.ttl() {
+			c.remove(k)
+		}
+	}
+}
+
+func (c *changeCache) remove(k string) {
+	if e, ok := c.entries[k]; ok {
+		c.lru.Remove(e.element)
+		delete(c.entries, k)
+	}
+}
+
+func (c *changeCache) forget(sub *Subscription) {
+	for _, e := range c.entries {
+		delete(e.seen, sub)
+	}
+}
+
+func (c *changeCache) len() int {
+	return len(c.entries)
+}
@@ -1,8 +1,11 @@
 package subscription
 
 import (
+	"slices"
 	"sync"
+	"time"
 
+	"github.com/holoplot/go-racket/pkg/racket/clock"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	"github.com/holoplot/go-racket/pkg/racket/subject"
 )
@@ -23,34 +26,183 @@ func (s *OptOnlyOnChange) apply(sub *Subscription) {
 	sub.onlyOnChange = true
 }
 
+type OptReplay struct{}
+
+// Replay makes the subscription start with the last known value of every
+// matching subject, as far as the receiver caches them.
+func Replay() Opt {
+	return &OptReplay{}
+}
+
+func (s *OptReplay) apply(sub *Subscription) {
+	sub.replay = true
+}
+
+type OptBufferLatest struct{}
+
+// BufferLatest keeps the latest message of each subject while the
+// subscription is paused, and delivers them on Resume. Without it, messages
+// that arrive while paused are dropped.
+func BufferLatest() Opt {
+	return &OptBufferLatest{}
+}
+
+func (s *OptBufferLatest) apply(sub *Subscription) {
+	sub.bufferLatest = true
+}
+
+// Subscription is the handle of a subscription. All its state is guarded by
+// the lock of the tree it belongs to, which is not held while callbacks run,
+// so callbacks may close, pause and resume any subscription.
 type Subscription struct {
+	tree         *Tree
 	cb           Callback
 	onlyOnChange bool
-	contentHash  map[string]string
+	replay       bool
+	removed      bool
+	bufferLatest bool
+
+	paused  bool
+	pending []*message.Message
+	stats   SubscriptionStats
+
+	// Until the replay, the subjects dispatched since the subscription was
+	// added. Afterwards, the messages replayed, so that they are not
+	// dispatched again.
+	live     map[string]bool
+	replayed map[string]*message.Message
 }
 
-type node struct {
-	subscriptions []*Subscription
-	children      map[string]*node
+// accept reports whether msg is to be delivered to sub, which is not the
+// case if it was replayed already. The lock must be held.
+func (sub *Subscription) accept(msg *message.Message) bool {
+	k := msg.Subject.String()
+
+	if m, ok := sub.replayed[k]; ok {
+		delete(sub.replayed, k)
+
+		if m == msg {
+			return false
+		}
+	}
+
+	if sub.live != nil {
+		sub.live[k] = true
+	}
+
+	return true
 }
 
-func (n *node) Dispatch(msg *message.Message) uint64 {
-	dispatched := uint64(0)
+// prepare reports whether the callback is to be called with msg, and counts
+// the delivery. Messages for removed subscriptions are dropped, and those
+// for paused ones kept or dropped. The lock must be held.
+func (sub *Subscription) prepare(msg *message.Message) bool {
+	if sub.removed {
+		return false
+	}
 
-	for _, sub := range n.subscriptions {
-		if sub.onlyOnChange {
-			if sub.contentHash[msg.Subject.String()] == msg.Hash() {
-				continue
-			}
+	if sub.paused {
+		if !sub.bufferLatest {
+			sub.stats.Dropped++
+			return false
+		}
+
+		k := msg.Subject.String()
+		i := slices.IndexFunc(sub.pending, func(m *message.Message) bool {
+			return m.Subject.String() == k
+		})
 
-			sub.contentHash[msg.Subject.String()] = msg.Hash()
+		if i >= 0 {
+			sub.pending[i] = msg
+		} else {
+			sub.pending = append(sub.pending, msg)
 		}
 
-		sub.cb(msg)
-		dispatched++
+		return false
 	}
 
-	return dispatched
+	if sub.onlyOnChange && !sub.tree.changes.changed(sub, msg, sub.tree.clock.Now()) {
+		return false
+	}
+
+	sub.stats.Delivered++
+	sub.stats.LastDelivery = sub.tree.clock.Now()
+
+	return true
+}
+
+// Close removes the subscription from its tree, and lets the receiver leave
+// the groups of the stream if it was the last one. Messages that were not
+// delivered yet are dropped.
+func (sub *Subscription) Close() {
+	sub.tree.Remove(sub)
+}
+
+// Pause stops the delivery of messages until Resume is called.
+func (sub *Subscription) Pause() {
+	sub.tree.mutex.Lock()
+	defer sub.tree.mutex.Unlock()
+
+	sub.paused = true
+}
+
+// Resume continues the delivery of messages, starting with the ones kept
+// while paused. Called from a callback, they are delivered once it returns.
+func (sub *Subscription) Resume() {
+	t := sub.tree
+
+	t.mutex.Lock()
+
+	if !sub.paused {
+		t.mutex.Unlock()
+		return
+	}
+
+	sub.paused = false
+
+	for _, msg := range sub.pending {
+		t.queue = append(t.queue, delivery{sub: sub, msg: msg})
+	}
+
+	sub.pending = nil
+
+	t.mutex.Unlock()
+
+	t.deliver()
+}
+
+// SubscriptionStats describes the deliveries of a single subscription.
+type SubscriptionStats struct {
+	Delivered    uint64    `json:"delivered,omitempty"`
+	Dropped      uint64    `json:"dropped,omitempty"`
+	Pending      int       `json:"pending,omitempty"`
+	Paused       bool      `json:"paused,omitempty"`
+	LastDelivery time.Time `json:"last_delivery"`
+}
+
+func (sub *Subscription) Stats() SubscriptionStats {
+	sub.tree.mutex.Lock()
+	defer sub.tree.mutex.Unlock()
+
+	stats := sub.stats
+	stats.Pending = len(sub.pending)
+	stats.Paused = sub.paused
+
+	return stats
+}
+
+type node struct {
+	subscriptions []*Subscription
+	children      map[string]*node
+}
+
+// dispatch queues msg for the subscriptions of the node.
+func (n *node) dispatch(t *Tree, msg *message.Message) {
+	for _, sub := range n.subscriptions {
+		if sub.accept(msg) {
+			t.queue = append(t.queue, delivery{sub: sub, msg: msg, counted: true})
+		}
+	}
 }
 
 func (n *node) countChildren() int {
@@ -97,9 +249,63 @@ func (sn *node) removeSubscription(sub *Subscription) {
 	}
 }
 
+type TreeOpt interface {
+	applyTree(*Tree)
+}
+
+type OptClock struct {
+	clock clock.Clock
+}
+
+// Clock sets the clock used for the times in the stats.
+func Clock(c clock.Clock) TreeOpt {
+	return &OptClock{
+		clock: c,
+	}
+}
+
+func (o *OptClock) applyTree(t *Tree) {
+	t.clock = o.clock
+}
+
+type OptChangeCacheSize struct {
+	size int
+}
+
+// ChangeCacheSize sets the number of subjects whose values are remembered
+// for the OnlyOnChange subscriptions of the tree. It defaults to
+// DefaultChangeCacheSize. Sizes below one are ignored.
+func ChangeCacheSize(size int) TreeOpt {
+	return &OptChangeCacheSize{
+		size: size,
+	}
+}
+
+func (o *OptChangeCacheSize) applyTree(t *Tree) {
+	if o.size > 0 {
+		t.changes.size = o.size
+	}
+}
+
+// delivery is a message on its way to a subscription. Only those of
+// dispatched and replayed messages are counted.
+type delivery struct {
+	sub     *Subscription
+	msg     *message.Message
+	counted bool
+}
+
 type Tree struct {
-	mutex sync.Mutex
-	root  *node
+	mutex    sync.Mutex
+	root     *node
+	clock    clock.Clock
+	changes  *changeCache
+	onRemove func()
+
+	// Deliveries whose callbacks have yet to run, and whether a caller is
+	// running them
+	queue      []delivery
+	delivering bool
 }
 
 func (t *Tree) Add(s subject.Subject, callback Callback, opts ...Opt) *Subscription {
@@ -120,14 +326,18 @@ func (t *Tree) Add(s subject.Subject, callback Callback, opts ...Opt) *Subscript
 	}
 
 	sub := &Subscription{
-		cb:          callback,
-		contentHash: make(map[string]string),
+		tree: t,
+		cb:   callback,
 	}
 
 	for _, opt := range opts {
 		opt.apply(sub)
 	}
 
+	if sub.replay {
+		sub.live = make(map[string]bool)
+	}
+
 	node.subscriptions = append(node.subscriptions, sub)
 
 	return sub
@@ -135,44 +345,160 @@ func (t *Tree) Add(s subject.Subject, callback Callback, opts ...Opt) *Subscript
 
 func (t *Tree) Remove(sub *Subscription) {
 	t.mutex.Lock()
-	defer t.mutex.Unlock()
+
+	if sub.removed {
+		t.mutex.Unlock()
+		return
+	}
 
 	t.root.removeSubscription(sub)
+	t.changes.forget(sub)
+	sub.removed = true
+	sub.pending = nil
+
+	onRemove := t.onRemove
+
+	t.mutex.Unlock()
+
+	if onRemove != nil {
+		onRemove()
+	}
 }
 
-func (t *Tree) Dispatch(msg *message.Message) uint64 {
+// OnRemove sets a function that is called after a subscription was
+// removed, without the lock of the tree held.
+func (t *Tree) OnRemove(f func()) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	dispatched := uint64(0)
+	t.onRemove = f
+}
+
+// Replay delivers the messages returned by cached to sub, if it was added
+// with the Replay option. Subjects that were dispatched to sub since it was
+// added are skipped, and replayed messages are not dispatched again. The
+// messages are fetched after the tree is locked, so nothing is dispatched
+// in between.
+func (t *Tree) Replay(sub *Subscription, cached func() []*message.Message) uint64 {
+	t.mutex.Lock()
+
+	if sub.live == nil || sub.removed {
+		t.mutex.Unlock()
+		return 0
+	}
+
+	live := sub.live
+	sub.live = nil
+	sub.replayed = make(map[string]*message.Message)
+
+	for _, msg := range cached() {
+		if live[msg.Subject.String()] {
+			continue
+		}
+
+		t.queue = append(t.queue, delivery{sub: sub, msg: msg, counted: true})
+		sub.replayed[msg.Subject.String()] = msg
+	}
+
+	t.mutex.Unlock()
+
+	return t.deliver()
+}
+
+// Dispatch delivers msg to the matching subscriptions and returns the number
+// of deliveries it made. Callbacks of the tree run one at a time and in
+// order, so if another call is delivering already, msg is left to it and
+// counted there.
+func (t *Tree) Dispatch(msg *message.Message) uint64 {
+	t.mutex.Lock()
 
 	node := t.root
 	for _, part := range msg.Subject.Parts {
-		dispatched += node.Dispatch(msg)
+		node.dispatch(t, msg)
 
-		if child, ok := node.children[part]; ok {
-			node = child
-		} else {
+		child, ok := node.children[part]
+		if !ok {
 			// We have reached the end of the subject parts, and
 			// there are no more children to traverse.
-			return dispatched
+			node = nil
+			break
+		}
+
+		node = child
+	}
+
+	if node != nil {
+		node.dispatch(t, msg)
+	}
+
+	t.mutex.Unlock()
+
+	return t.deliver()
+}
+
+// deliver runs the callbacks of the queued deliveries, without the lock
+// held, unless another call does so already. It returns the number of
+// counted deliveries made.
+func (t *Tree) deliver() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.delivering {
+		return 0
+	}
+
+	t.delivering = true
+	defer func() { t.delivering = false }()
+
+	dispatched := uint64(0)
+
+	for len(t.queue) > 0 {
+		d := t.queue[0]
+		t.queue[0] = delivery{}
+		t.queue = t.queue[1:]
+
+		if !d.sub.prepare(d.msg) {
+			continue
+		}
+
+		if d.counted {
+			dispatched++
 		}
+
+		t.unlocked(func() { d.sub.cb(d.msg) })
 	}
 
-	dispatched += node.Dispatch(msg)
+	t.queue = nil
 
 	return dispatched
 }
 
-func NewTree() *Tree {
-	return &Tree{
-		root: newNode(),
+// unlocked runs f with the lock released.
+func (t *Tree) unlocked(f func()) {
+	t.mutex.Unlock()
+	defer t.mutex.Lock()
+
+	f()
+}
+
+func NewTree(opts ...TreeOpt) *Tree {
+	t := &Tree{
+		root:    newNode(),
+		clock:   clock.Real,
+		changes: newChangeCache(DefaultChangeCacheSize),
 	}
+
+	for _, opt := range opts {
+		opt.applyTree(t)
+	}
+
+	return t
 }
 
 type Stats struct {
 	NodesCount         int `json:"nodes_count,omitempty"`
 	SubscriptionsCount int `json:"subscriptions_count,omitempty"`
+	ChangeCacheCount   int `json:"change_cache_count,omitempty"`
 }
 
 func (t *Tree) Stats() Stats {
@@ -182,5 +508,6 @@ func (t *Tree) Stats() Stats {
 	return Stats{
 		NodesCount:         t.root.countChildren(),
 		SubscriptionsCount: t.root.countSubscriptions(),
+		ChangeCacheCount:   t.changes.len(),
 	}
 }
@@ -1,8 +1,11 @@
 package subscription
 
 import (
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/holoplot/go-racket/pkg/racket/clock"
 	"github.com/holoplot/go-racket/pkg/racket/message"
 	"github.com/holoplot/go-racket/pkg/racket/subject"
 )
@@ -116,3 +119,336 @@ func TestNewTree(t *testing.T) {
 		t.Fatal("expected root node to be created, got nil")
 	}
 }
+
+func TestTree_Replay(t *testing.T) {
+	tree := NewTree()
+
+	var got []string
+	callback := func(msg *message.Message) {
+		got = append(got, string(msg.Data))
+	}
+
+	a := &message.Message{Subject: subject.Subject{Parts: []string{"a"}}, Data: []byte("a1")}
+	b := &message.Message{Subject: subject.Subject{Parts: []string{"b"}}, Data: []byte("b1")}
+	b2 := &message.Message{Subject: subject.Subject{Parts: []string{"b"}}, Data: []byte("b2")}
+
+	sub := tree.Add(subject.Subject{Parts: []string{"*"}}, callback, Replay())
+
+	// b2 is dispatched before the replay, which then skips b.
+	tree.Dispatch(b2)
+
+	if n := tree.Replay(sub, func() []*message.Message { return []*message.Message{a, b} }); n != 1 {
+		t.Errorf("expected 1 replayed message, got %d", n)
+	}
+
+	// The replayed message is not dispatched again, but later ones are.
+	tree.Dispatch(a)
+	tree.Dispatch(a)
+
+	if want := []string{"b2", "a1", "a1"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	// Subscriptions without the option are not replayed to.
+	other := tree.Add(subject.Subject{Parts: []string{"*"}}, callback)
+
+	if n := tree.Replay(other, func() []*message.Message { return []*message.Message{a} }); n != 0 {
+		t.Errorf("expected no replay, got %d", n)
+	}
+}
+
+func TestSubscription_PauseResume(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		opts    []Opt
+		want    []string
+		dropped uint64
+	}{
+		{"drop", nil, []string{"a1", "a4"}, 3},
+		{"buffer latest", []Opt{BufferLatest()}, []string{"a1", "a3", "b1", "a4"}, 0},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+			tree := NewTree(Clock(c))
+
+			var got []string
+			sub := tree.Add(subject.Subject{Parts: []string{"*"}}, func(msg *message.Message) {
+				got = append(got, string(msg.Data))
+			}, test.opts...)
+
+			msg := func(subj, data string) *message.Message {
+				return &message.Message{Subject: subject.Subject{Parts: []string{subj}}, Data: []byte(data)}
+			}
+
+			tree.Dispatch(msg("a", "a1"))
+			sub.Pause()
+			tree.Dispatch(msg("a", "a2"))
+			tree.Dispatch(msg("b", "b1"))
+			tree.Dispatch(msg("a", "a3"))
+
+			if stats := sub.Stats(); !stats.Paused || stats.Dropped != test.dropped {
+				t.Errorf("unexpected stats while paused %+v", stats)
+			}
+
+			c.Advance(time.Second)
+			sub.Resume()
+			tree.Dispatch(msg("a", "a4"))
+
+			if !slices.Equal(got, test.want) {
+				t.Errorf("expected %v, got %v", test.want, got)
+			}
+
+			stats := sub.Stats()
+			if stats.Paused || stats.Pending != 0 || stats.Delivered != uint64(len(test.want)) || !stats.LastDelivery.Equal(c.Now()) {
+				t.Errorf("unexpected stats %+v", stats)
+			}
+		})
+	}
+}
+
+func TestSubscription_Close(t *testing.T) {
+	tree := NewTree()
+
+	removed := 0
+	tree.OnRemove(func() {
+		removed++
+	})
+
+	called := false
+	sub := tree.Add(subject.Subject{Parts: []string{"a"}}, func(*message.Message) {
+		called = true
+	})
+
+	sub.Close()
+	sub.Close()
+
+	tree.Dispatch(&message.Message{Subject: subject.Subject{Parts: []string{"a"}}})
+
+	if called {
+		t.Error("expected no delivery after close")
+	}
+
+	if removed != 1 {
+		t.Errorf("expected one removal, got %d", removed)
+	}
+}
+
+// withinCallbacks fails the test if f does not return, which happens if
+// callbacks cannot use subscriptions.
+func withinCallbacks(t *testing.T, f func()) {
+	t.Helper()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		f()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callback blocked on the tree")
+	}
+}
+
+func TestSubscription_CloseFromCallback(t *testing.T) {
+	tree := NewTree()
+	all := subject.Subject{Parts: []string{"*"}}
+
+	var (
+		got   []string
+		other *Subscription
+	)
+
+	var sub *Subscription
+	sub = tree.Add(all, func(msg *message.Message) {
+		got = append(got, "sub:"+string(msg.Data))
+
+		// The subscription closes itself and the other one, which does
+		// not get the message any more.
+		sub.Close()
+		other.Close()
+	})
+
+	other = tree.Add(all, func(msg *message.Message) {
+		got = append(got, "other:"+string(msg.Data))
+	})
+
+	withinCallbacks(t, func() {
+		tree.Dispatch(&message.Message{Subject: subject.Subject{Parts: []string{"a"}}, Data: []byte("1")})
+		tree.Dispatch(&message.Message{Subject: subject.Subject{Parts: []string{"a"}}, Data: []byte("2")})
+	})
+
+	if !slices.Equal(got, []string{"sub:1"}) {
+		t.Errorf("unexpected deliveries %v", got)
+	}
+
+	if n := tree.Stats().SubscriptionsCount; n != 0 {
+		t.Errorf("expected no subscriptions, got %d", n)
+	}
+}
+
+func TestSubscription_PauseResumeFromCallback(t *testing.T) {
+	tree := NewTree()
+
+	msg := func(subj, data string) *message.Message {
+		return &message.Message{Subject: subject.Subject{Parts: []string{subj}}, Data: []byte(data)}
+	}
+
+	var got []string
+
+	var sub *Subscription
+	sub = tree.Add(subject.Subject{Parts: []string{"a"}}, func(msg *message.Message) {
+		got = append(got, string(msg.Data))
+
+		// The subscription pauses itself after the first message.
+		if sub.Stats().Delivered == 1 {
+			sub.Pause()
+		}
+	}, BufferLatest())
+
+	// Another subscription resumes it, and the buffered message is
+	// delivered once its callback returns.
+	tree.Add(subject.Subject{Parts: []string{"resume"}}, func(*message.Message) {
+		sub.Resume()
+		got = append(got, "resumed")
+	})
+
+	withinCallbacks(t, func() {
+		tree.Dispatch(msg("a", "a1"))
+		tree.Dispatch(msg("a", "a2"))
+
+		if stats := sub.Stats(); !stats.Paused || stats.Pending != 1 {
+			t.Errorf("unexpected stats while paused %+v", stats)
+		}
+
+		if n := tree.Dispatch(msg("resume", "")); n != 1 {
+			t.Errorf("expected one dispatched message, got %d", n)
+		}
+
+		tree.Dispatch(msg("a", "a3"))
+	})
+
+	if want := []string{"a1", "resumed", "a2", "a3"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestTree_OnlyOnChangeState(t *testing.T) {
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	tree := NewTree(Clock(c), ChangeCacheSize(2))
+
+	msg := func(subj, data string) *message.Message {
+		return &message.Message{Subject: subject.Subject{Parts: []string{subj}}, Data: []byte(data)}
+	}
+
+	var a, b []string
+	tree.Add(subject.Subject{Parts: []string{"*"}}, func(msg *message.Message) {
+		a = append(a, string(msg.Data))
+	}, OnlyOnChange())
+
+	tree.Dispatch(msg("x", "1"))
+
+	// A subscription added later still sees the unchanged value once.
+	sub := tree.Add(subject.Subject{Parts: []string{"x"}}, func(msg *message.Message) {
+		b = append(b, string(msg.Data))
+	}, OnlyOnChange())
+
+	tree.Dispatch(msg("x", "1"))
+	tree.Dispatch(msg("x", "1"))
+
+	if !slices.Equal(a, []string{"1"}) || !slices.Equal(b, []string{"1"}) {
+		t.Fatalf("unexpected deliveries %v, %v", a, b)
+	}
+
+	// Tombstones are delivered and clear the state of the subject.
+	tombstone := msg("x", "")
+	tombstone.Tombstone = true
+	tree.Dispatch(tombstone)
+	tree.Dispatch(msg("x", "1"))
+
+	if !slices.Equal(a, []string{"1", "", "1"}) {
+		t.Errorf("unexpected deliveries %v", a)
+	}
+
+	// The state is bounded by the size of the cache.
+	tree.Dispatch(msg("y", "1"))
+	tree.Dispatch(msg("z", "1"))
+
+	if n := tree.Stats().ChangeCacheCount; n != 2 {
+		t.Errorf("expected 2 cached subjects, got %d", n)
+	}
+
+	tree.Dispatch(msg("x", "1"))
+
+	if !slices.Equal(a, []string{"1", "", "1", "1", "1", "1"}) {
+		t.Errorf("expected the evicted subject to be delivered again, got %v", a)
+	}
+
+	// Subjects expire when they are not seen for a few of their intervals.
+	c.Advance(time.Minute)
+	tree.Dispatch(msg("x", "1"))
+	tree.Dispatch(msg("z", "1"))
+
+	if !slices.Equal(a, []string{"1", "", "1", "1", "1", "1"}) {
+		t.Errorf("unexpected deliveries %v", a)
+	}
+
+	c.Advance(3*time.Minute + time.Second)
+	tree.Dispatch(msg("z", "1"))
+
+	if n := tree.Stats().ChangeCacheCount; n != 1 {
+		t.Errorf("expected the stale subject to expire, got %d cached subjects", n)
+	}
+
+	sub.Close()
+}
+
+func TestChangeEntry_Interval(t *testing.T) {
+	e := &changeEntry{}
+
+	for _, step := range []struct {
+		gap      time.Duration
+		expected time.Duration
+	}{
+		{10 * time.Second, 10 * time.Second},
+		// A catch-up answer shortens a single gap.
+		{time.Second, 10 * time.Second},
+		// An outage makes one gap long, which is forgotten later on.
+		{time.Hour, time.Hour},
+		{10 * time.Second, time.Hour},
+		{10 * time.Second, time.Hour},
+		{10 * time.Second, time.Hour},
+		{10 * time.Second, 10 * time.Second},
+		// A shorter interval is taken once it is the longest recent gap.
+		{5 * time.Second, 10 * time.Second},
+		{5 * time.Second, 10 * time.Second},
+		{5 * time.Second, 10 * time.Second},
+		{5 * time.Second, 5 * time.Second},
+	} {
+		e.observe(step.gap)
+
+		if e.interval != step.expected {
+			t.Errorf("after a gap of %s: expected interval %s, got %s", step.gap, step.expected, e.interval)
+		}
+	}
+}
+
+func TestTree_ChangeCacheSizeInvalid(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		tree := NewTree(ChangeCacheSize(size))
+
+		delivered := 0
+		tree.Add(subject.Subject{Parts: []string{"x"}}, func(*message.Message) {
+			delivered++
+		}, OnlyOnChange())
+
+		tree.Dispatch(&message.Message{Subject: subject.Subject{Parts: []string{"x"}}, Data: []byte("1")})
+		tree.Dispatch(&message.Message{Subject: subject.Subject{Parts: []string{"x"}}, Data: []byte("1")})
+
+		if delivered != 1 || tree.Stats().ChangeCacheCount != 1 {
+			t.Errorf("size %d: expected the default size, got %d deliveries", size, delivered)
+		}
+	}
+}
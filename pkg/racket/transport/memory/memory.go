@@ -0,0 +1,205 @@
+package memory
+
+import (
+	"encoding/binary"
+	"net"
+	"slices"
+	"sync"
+
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+)
+
+// Bus connects in-process transports as if they were attached to the same
+// multicast network. Packets are delivered synchronously, in the goroutine
+// of the sender, which keeps tests deterministic.
+type Bus struct {
+	mutex   sync.RWMutex
+	nextID  uint32
+	members map[string][]*membership
+}
+
+type membership struct {
+	transport *Transport
+	group     string
+	sources   []net.IP
+	handler   transport.Handler
+}
+
+func (m *membership) Close() {
+	m.transport.leave(m)
+}
+
+func (m *membership) accepts(src *net.UDPAddr) bool {
+	if len(m.sources) == 0 {
+		return true
+	}
+
+	for _, s := range m.sources {
+		if s.Equal(src.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		members: make(map[string][]*membership),
+	}
+}
+
+// NewTransport attaches a new endpoint to the bus. Each endpoint has a
+// unique IPv4 and IPv6 address that receivers see as packet source.
+func (b *Bus) NewTransport() *Transport {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.nextID++
+
+	addr4 := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(addr4, 10<<24|b.nextID)
+
+	addr6 := slices.Clone(net.ParseIP("fd00::"))
+	binary.BigEndian.PutUint32(addr6[12:], b.nextID)
+
+	return &Transport{
+		bus:   b,
+		addr4: addr4,
+		addr6: addr6,
+	}
+}
+
+func (b *Bus) join(m *membership) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	b.members[m.group] = append(b.members[m.group], m)
+}
+
+func (b *Bus) leave(m *membership) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	ms := b.members[m.group]
+
+	if i := slices.Index(ms, m); i >= 0 {
+		b.members[m.group] = slices.Delete(ms, i, i+1)
+	}
+
+	if len(b.members[m.group]) == 0 {
+		delete(b.members, m.group)
+	}
+}
+
+func (b *Bus) deliver(payload []byte, src, group *net.UDPAddr) {
+	b.mutex.RLock()
+	ms := slices.Clone(b.members[group.String()])
+	b.mutex.RUnlock()
+
+	for _, m := range ms {
+		if m.accepts(src) {
+			m.handler(slices.Clone(payload), src, "")
+		}
+	}
+}
+
+// Groups returns the groups that currently have at least one member.
+func (b *Bus) Groups() []string {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	groups := make([]string, 0, len(b.members))
+
+	for g := range b.members {
+		groups = append(groups, g)
+	}
+
+	slices.Sort(groups)
+
+	return groups
+}
+
+type Transport struct {
+	mutex sync.Mutex
+
+	bus         *Bus
+	addr4       net.IP
+	addr6       net.IP
+	closed      bool
+	memberships []*membership
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+// Addr returns the address the endpoint sends from to groups of the same
+// family as group.
+func (t *Transport) Addr(group net.IP) *net.UDPAddr {
+	if group.To4() != nil {
+		return &net.UDPAddr{IP: t.addr4}
+	}
+
+	return &net.UDPAddr{IP: t.addr6}
+}
+
+func (t *Transport) Send(payload []byte, group *net.UDPAddr) error {
+	t.mutex.Lock()
+	closed := t.closed
+	t.mutex.Unlock()
+
+	if closed {
+		return net.ErrClosed
+	}
+
+	t.bus.deliver(payload, t.Addr(group.IP), group)
+
+	return nil
+}
+
+func (t *Transport) Join(group *net.UDPAddr, h transport.Handler, sources ...net.IP) (transport.Membership, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return nil, net.ErrClosed
+	}
+
+	m := &membership{
+		transport: t,
+		group:     group.String(),
+		sources:   slices.Clone(sources),
+		handler:   h,
+	}
+
+	t.memberships = append(t.memberships, m)
+	t.bus.join(m)
+
+	return m, nil
+}
+
+func (t *Transport) leave(m *membership) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	i := slices.Index(t.memberships, m)
+	if i < 0 {
+		return
+	}
+
+	t.memberships = slices.Delete(t.memberships, i, i+1)
+	t.bus.leave(m)
+}
+
+func (t *Transport) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, m := range t.memberships {
+		t.bus.leave(m)
+	}
+
+	t.memberships = nil
+	t.closed = true
+
+	return nil
+}
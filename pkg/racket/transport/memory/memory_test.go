@@ -0,0 +1,116 @@
+package memory
+
+import (
+	"net"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	a := bus.NewTransport()
+	b := bus.NewTransport()
+
+	group := &net.UDPAddr{IP: net.ParseIP("239.0.0.1"), Port: 19090}
+	other := &net.UDPAddr{IP: net.ParseIP("239.0.0.1"), Port: 19091}
+
+	var received [][]byte
+	var sources []net.Addr
+
+	m, err := b.Join(group, func(payload []byte, src net.Addr, _ string) {
+		received = append(received, payload)
+		sources = append(sources, src)
+	})
+	if err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	payload := []byte("foo")
+
+	if err := a.Send(payload, group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if err := a.Send(payload, other); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if len(received) != 1 || string(received[0]) != "foo" {
+		t.Fatalf("expected to receive one packet, got %q", received)
+	}
+
+	if sources[0].String() != a.Addr(group.IP).String() {
+		t.Errorf("expected source %s, got %s", a.Addr(group.IP), sources[0])
+	}
+
+	// Handlers own their payload.
+	payload[0] = 'b'
+	if string(received[0]) != "foo" {
+		t.Error("payload was not copied")
+	}
+
+	if groups := bus.Groups(); len(groups) != 1 || groups[0] != group.String() {
+		t.Errorf("expected groups [%s], got %v", group, groups)
+	}
+
+	m.Close()
+
+	if err := a.Send(payload, group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if len(received) != 1 {
+		t.Errorf("expected no delivery after leaving, got %d packets", len(received))
+	}
+
+	if groups := bus.Groups(); len(groups) != 0 {
+		t.Errorf("expected no groups, got %v", groups)
+	}
+}
+
+func TestBus_Sources(t *testing.T) {
+	bus := NewBus()
+	a := bus.NewTransport()
+	b := bus.NewTransport()
+	c := bus.NewTransport()
+
+	group := &net.UDPAddr{IP: net.ParseIP("232.0.0.1"), Port: 19090}
+
+	received := 0
+
+	if _, err := c.Join(group, func([]byte, net.Addr, string) { received++ }, a.Addr(group.IP).IP); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	for _, tr := range []*Transport{a, b} {
+		if err := tr.Send([]byte("foo"), group); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	if received != 1 {
+		t.Errorf("expected only the packet of the joined source, got %d", received)
+	}
+}
+
+func TestTransport_Close(t *testing.T) {
+	bus := NewBus()
+	a := bus.NewTransport()
+
+	group := &net.UDPAddr{IP: net.ParseIP("239.0.0.1"), Port: 19090}
+
+	if _, err := a.Join(group, func([]byte, net.Addr, string) {}); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if groups := bus.Groups(); len(groups) != 0 {
+		t.Errorf("expected no groups after close, got %v", groups)
+	}
+
+	if err := a.Send([]byte("foo"), group); err == nil {
+		t.Error("expected error sending on closed transport, got nil")
+	}
+}
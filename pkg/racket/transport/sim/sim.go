@@ -0,0 +1,228 @@
+package sim
+
+import (
+	"math/rand/v2"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+	"github.com/holoplot/go-racket/pkg/racket/transport/memory"
+)
+
+// Config describes the impairments of a simulated network. Probabilities
+// are in the range 0 to 1 and apply to each packet per receiving endpoint.
+type Config struct {
+	Loss      float64 `json:"loss,omitempty"`
+	Duplicate float64 `json:"duplicate,omitempty"`
+	Reorder   float64 `json:"reorder,omitempty"`
+
+	// Every packet is delayed by Delay plus a random amount up to Jitter.
+	Delay  time.Duration `json:"delay,omitempty"`
+	Jitter time.Duration `json:"jitter,omitempty"`
+
+	// Reordered packets are held back by this much on top, so that
+	// subsequent packets overtake them. Defaults to 10ms.
+	ReorderDelay time.Duration `json:"reorder_delay,omitempty"`
+
+	// Seed makes the impairment decisions reproducible for a given
+	// sequence of packets.
+	Seed uint64 `json:"seed,omitempty"`
+
+	// Clock schedules delayed packets. Defaults to the system clock.
+	Clock clock.Clock `json:"-"`
+}
+
+type Stats struct {
+	Packets     uint64 `json:"packets,omitempty"`
+	Delivered   uint64 `json:"delivered,omitempty"`
+	Lost        uint64 `json:"lost,omitempty"`
+	Duplicated  uint64 `json:"duplicated,omitempty"`
+	Reordered   uint64 `json:"reordered,omitempty"`
+	Partitioned uint64 `json:"partitioned,omitempty"`
+}
+
+type link struct {
+	from, to *Transport
+}
+
+// Network is an in-process multicast network with configurable
+// impairments, for testing behaviour under packet loss.
+type Network struct {
+	mutex sync.Mutex
+
+	bus        *memory.Bus
+	rng        *rand.Rand
+	config     Config
+	stats      Stats
+	endpoints  map[string]*Transport
+	partitions map[link]bool
+}
+
+func New(config Config) *Network {
+	n := &Network{
+		bus:        memory.NewBus(),
+		endpoints:  make(map[string]*Transport),
+		partitions: make(map[link]bool),
+	}
+
+	n.SetConfig(config)
+
+	return n
+}
+
+// SetConfig replaces the impairments and reseeds the random source.
+func (n *Network) SetConfig(config Config) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if config.ReorderDelay == 0 {
+		config.ReorderDelay = 10 * time.Millisecond
+	}
+
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+
+	n.config = config
+	n.rng = rand.New(rand.NewPCG(config.Seed, config.Seed))
+}
+
+func (n *Network) Stats() Stats {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.stats
+}
+
+// NewTransport attaches a new endpoint to the network.
+func (n *Network) NewTransport() *Transport {
+	t := &Transport{
+		Transport: n.bus.NewTransport(),
+		network:   n,
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.endpoints[t.Addr(net.IPv4zero).IP.String()] = t
+	n.endpoints[t.Addr(net.IPv6zero).IP.String()] = t
+
+	return t
+}
+
+// Partition cuts the connection between two endpoints in both directions.
+func (n *Network) Partition(a, b *Transport) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.partitions[link{a, b}] = true
+	n.partitions[link{b, a}] = true
+}
+
+// Isolate cuts the connection between an endpoint and all others.
+func (n *Network) Isolate(t *Transport) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	for _, other := range n.endpoints {
+		if other != t {
+			n.partitions[link{t, other}] = true
+			n.partitions[link{other, t}] = true
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (n *Network) Heal() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	clear(n.partitions)
+}
+
+// Groups returns the groups that currently have at least one member.
+func (n *Network) Groups() []string {
+	return n.bus.Groups()
+}
+
+// impair decides the fate of a packet from src to the endpoint to and
+// returns the delays of the copies to deliver, along with the clock to
+// schedule them on.
+func (n *Network) impair(src net.Addr, to *Transport) ([]time.Duration, clock.Clock) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.stats.Packets++
+
+	if udpAddr, ok := src.(*net.UDPAddr); ok {
+		if from, ok := n.endpoints[udpAddr.IP.String()]; ok && n.partitions[link{from, to}] {
+			n.stats.Partitioned++
+			return nil, nil
+		}
+	}
+
+	if n.rng.Float64() < n.config.Loss {
+		n.stats.Lost++
+		return nil, nil
+	}
+
+	copies := 1
+
+	if n.rng.Float64() < n.config.Duplicate {
+		n.stats.Duplicated++
+		copies++
+	}
+
+	delays := make([]time.Duration, 0, copies)
+
+	for range copies {
+		d := n.config.Delay
+
+		if n.config.Jitter > 0 {
+			d += time.Duration(n.rng.Int64N(int64(n.config.Jitter)))
+		}
+
+		if n.rng.Float64() < n.config.Reorder {
+			n.stats.Reordered++
+			d += n.config.ReorderDelay
+		}
+
+		delays = append(delays, d)
+	}
+
+	n.stats.Delivered += uint64(copies)
+
+	return delays, n.config.Clock
+}
+
+// Transport is an endpoint of a simulated network. Impairments are applied
+// on the receiving side, so each receiver sees its own pattern of loss.
+type Transport struct {
+	*memory.Transport
+
+	network *Network
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+func (t *Transport) Join(group *net.UDPAddr, h transport.Handler, sources ...net.IP) (transport.Membership, error) {
+	return t.Transport.Join(group, func(payload []byte, src net.Addr, path string) {
+		delays, c := t.network.impair(src, t)
+
+		for _, d := range delays {
+			if d == 0 {
+				h(slices.Clone(payload), src, path)
+				continue
+			}
+
+			p := slices.Clone(payload)
+
+			c.AfterFunc(d, func() {
+				h(p, src, path)
+			})
+		}
+	}, sources...)
+}
@@ -0,0 +1,306 @@
+package sim
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/holoplot/go-racket/pkg/racket/clock"
+	"github.com/holoplot/go-racket/pkg/racket/message"
+	multicastpool "github.com/holoplot/go-racket/pkg/racket/multicast-pool"
+	receiver "github.com/holoplot/go-racket/pkg/racket/receiver"
+	sender "github.com/holoplot/go-racket/pkg/racket/sender"
+	"github.com/holoplot/go-racket/pkg/racket/subject"
+)
+
+var group = &net.UDPAddr{IP: net.ParseIP("239.0.0.1"), Port: 19090}
+
+func countDeliveries(t *testing.T, config Config, packets int) (int, Stats) {
+	t.Helper()
+
+	n := New(config)
+	a := n.NewTransport()
+	b := n.NewTransport()
+
+	received := 0
+
+	if _, err := b.Join(group, func([]byte, net.Addr, string) { received++ }); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	for range packets {
+		if err := a.Send([]byte("foo"), group); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+	}
+
+	return received, n.Stats()
+}
+
+func TestNetwork_Deterministic(t *testing.T) {
+	config := Config{
+		Loss:      0.3,
+		Duplicate: 0.1,
+		Seed:      42,
+	}
+
+	first, stats := countDeliveries(t, config, 1000)
+	second, _ := countDeliveries(t, config, 1000)
+
+	if first != second {
+		t.Errorf("expected identical results for the same seed, got %d and %d", first, second)
+	}
+
+	if stats.Packets != 1000 || stats.Lost < 200 || stats.Lost > 400 || stats.Duplicated == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if uint64(first) != stats.Delivered {
+		t.Errorf("expected %d deliveries, got %d", stats.Delivered, first)
+	}
+
+	config.Seed = 43
+
+	if third, _ := countDeliveries(t, config, 1000); third == first {
+		t.Errorf("expected different results for a different seed, got %d both times", first)
+	}
+}
+
+func TestNetwork_Reorder(t *testing.T) {
+	n := New(Config{Reorder: 1, ReorderDelay: 20 * time.Millisecond})
+	a := n.NewTransport()
+	b := n.NewTransport()
+
+	received := make(chan string, 2)
+
+	if _, err := b.Join(group, func(payload []byte, _ net.Addr, _ string) { received <- string(payload) }); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	if err := a.Send([]byte("first"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	n.SetConfig(Config{})
+
+	if err := a.Send([]byte("second"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if got := <-received; got != "second" {
+		t.Errorf("expected reordered delivery, got %q first", got)
+	}
+
+	if got := <-received; got != "first" {
+		t.Errorf("expected delayed packet, got %q", got)
+	}
+}
+
+func TestNetwork_Delay(t *testing.T) {
+	c := clock.NewFake(time.Now())
+
+	n := New(Config{Delay: time.Second, Clock: c})
+	a := n.NewTransport()
+	b := n.NewTransport()
+
+	received := 0
+
+	if _, err := b.Join(group, func([]byte, net.Addr, string) { received++ }); err != nil {
+		t.Fatalf("failed to join: %v", err)
+	}
+
+	if err := a.Send([]byte("foo"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	c.Advance(999 * time.Millisecond)
+
+	if received != 0 {
+		t.Fatal("packet delivered early")
+	}
+
+	c.Advance(time.Millisecond)
+
+	if received != 1 {
+		t.Fatalf("expected packet to be delivered after delay, got %d", received)
+	}
+}
+
+func TestNetwork_Partition(t *testing.T) {
+	n := New(Config{})
+	a := n.NewTransport()
+	b := n.NewTransport()
+	c := n.NewTransport()
+
+	var mutex sync.Mutex
+	received := make(map[string]int)
+
+	for name, tr := range map[string]*Transport{"b": b, "c": c} {
+		if _, err := tr.Join(group, func([]byte, net.Addr, string) {
+			mutex.Lock()
+			received[name]++
+			mutex.Unlock()
+		}); err != nil {
+			t.Fatalf("failed to join: %v", err)
+		}
+	}
+
+	n.Partition(a, b)
+
+	if err := a.Send([]byte("foo"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	n.Heal()
+	n.Isolate(c)
+
+	if err := a.Send([]byte("foo"), group); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	if received["b"] != 1 || received["c"] != 1 {
+		t.Errorf("expected one packet on each receiver, got %v", received)
+	}
+
+	if stats := n.Stats(); stats.Partitioned != 2 {
+		t.Errorf("expected 2 partitioned packets, got %d", stats.Partitioned)
+	}
+}
+
+// eventually waits for cond, which depends on goroutines that react to the
+// fake clock.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestConvergence checks that the periodic resend brings receivers to the
+// latest value of every subject despite a lossy network.
+func TestConvergence(t *testing.T) {
+	const (
+		interval  = time.Second
+		subjects  = 20
+		intervals = 50
+	)
+
+	c := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	n := New(Config{
+		Loss:      0.5,
+		Duplicate: 0.2,
+		Reorder:   0.2,
+		Jitter:    interval / 2,
+		Seed:      1,
+		Clock:     c,
+	})
+
+	pool, err := multicastpool.Parse("239.1.0.0/16")
+	if err != nil {
+		t.Fatalf("failed to create pool: %v", err)
+	}
+
+	// The receiver misses the first values entirely, as well as the
+	// announcements and the answer to its catch-up request.
+	st, rt := n.NewTransport(), n.NewTransport()
+	n.Isolate(rt)
+
+	s, err := sender.NewWithTransport(st, pool, sender.Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	t.Cleanup(s.Close)
+
+	r, err := receiver.NewWithTransport(rt, pool, receiver.Clock(c))
+	if err != nil {
+		t.Fatalf("failed to create receiver: %v", err)
+	}
+
+	t.Cleanup(r.Close)
+
+	var mutex sync.Mutex
+	latest := make(map[string]string)
+
+	su, _ := subject.Parse("org.*")
+	if _, err := r.Subscribe("stream-1", su, func(msg *message.Message) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		latest[msg.Subject.String()] = string(msg.Data)
+	}); err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+
+	for version := range 6 {
+		for i := range subjects {
+			su, _ := subject.Parse(fmt.Sprintf("org.subject-%d", i))
+
+			if err := s.Publish(&message.Message{
+				Stream:   "stream-1",
+				Subject:  su,
+				Data:     []byte(fmt.Sprintf("v%d", version)),
+				Interval: interval,
+			}); err != nil {
+				t.Fatalf("failed to publish: %v", err)
+			}
+		}
+	}
+
+	n.Heal()
+
+	converged := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if len(latest) != subjects {
+			return false
+		}
+
+		for _, v := range latest {
+			if v != "v5" {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	sent := func() uint64 {
+		return s.Stats().Streams["stream-1"].MessagesSent
+	}
+
+	for i := 0; !converged(); i++ {
+		if i == intervals {
+			mutex.Lock()
+			snapshot := maps.Clone(latest)
+			mutex.Unlock()
+
+			t.Fatalf("receiver did not converge within %d intervals: %v", intervals, snapshot)
+		}
+
+		before := sent()
+		c.Advance(interval)
+
+		// Copies that the network delays are delivered by the next
+		// advance of the clock.
+		eventually(t, "the resend", func() bool {
+			return sent() >= before+subjects
+		})
+	}
+
+	if stats := n.Stats(); stats.Lost == 0 || stats.Partitioned == 0 {
+		t.Errorf("expected the network to impair traffic, got %+v", stats)
+	}
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"net"
+)
+
+// InterfaceError is returned by transports that send on several interfaces
+// for a failure on one of them. Several of them may be joined into one error.
+type InterfaceError struct {
+	Interface string
+	Err       error
+}
+
+func (e *InterfaceError) Error() string {
+	return e.Interface + ": " + e.Err.Error()
+}
+
+func (e *InterfaceError) Unwrap() error {
+	return e.Err
+}
+
+// PartialError is returned by transports that send on several interfaces
+// when a packet went out on some of them, but not on all.
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return "partially sent: " + e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// Handler is called for every packet received on a joined group. The
+// payload is owned by the handler. Path names the way the packet took,
+// such as the interface it arrived on, and is empty if the transport has
+// only one.
+type Handler func(payload []byte, src net.Addr, path string)
+
+// Membership is returned by Join and leaves the group when closed.
+type Membership interface {
+	Close()
+}
+
+// Transport carries packets between senders and receivers. Addresses are
+// multicast groups with a port, as handed out by a multicast pool.
+type Transport interface {
+	// Send sends payload to group on all paths of the transport. If it
+	// went out on some of them only, the error is a *PartialError.
+	Send(payload []byte, group *net.UDPAddr) error
+
+	// Join delivers the packets sent to group to h until the returned
+	// membership is closed. If sources are given, only packets from these
+	// addresses are delivered.
+	Join(group *net.UDPAddr, h Handler, sources ...net.IP) (Membership, error)
+
+	Close() error
+}
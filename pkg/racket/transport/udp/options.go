@@ -0,0 +1,92 @@
+package udp
+
+import (
+	"log/slog"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/multicast"
+)
+
+type Opt interface {
+	apply(*Transport)
+}
+
+type OptSocket struct {
+	options multicast.SocketOptions
+}
+
+// Socket sets the options of the sockets the transport opens.
+func Socket(o multicast.SocketOptions) Opt {
+	return &OptSocket{
+		options: o,
+	}
+}
+
+func (o *OptSocket) apply(t *Transport) {
+	t.options = o.options
+}
+
+type OptConcurrency struct {
+	concurrency int
+}
+
+// Concurrency limits the number of handlers that run at the same time.
+// Zero means no limit.
+func Concurrency(n int) Opt {
+	return &OptConcurrency{
+		concurrency: n,
+	}
+}
+
+func (o *OptConcurrency) apply(t *Transport) {
+	t.concurrency = o.concurrency
+}
+
+type OptLogger struct {
+	logger *slog.Logger
+}
+
+// Logger sets the logger. It defaults to slog.Default(), which a nil logger
+// keeps.
+func Logger(l *slog.Logger) Opt {
+	return &OptLogger{
+		logger: l,
+	}
+}
+
+func (o *OptLogger) apply(t *Transport) {
+	if o.logger != nil {
+		t.logger = o.logger
+	}
+}
+
+type OptOnEvent struct {
+	cb func(Event)
+}
+
+// OnEvent sets a callback for changes of the transport's interfaces.
+func OnEvent(cb func(Event)) Opt {
+	return &OptOnEvent{
+		cb: cb,
+	}
+}
+
+func (o *OptOnEvent) apply(t *Transport) {
+	t.onEvent = o.cb
+}
+
+type OptSelector struct {
+	selector *ifselect.Selector
+}
+
+// Selector makes the transport select its interfaces again whenever an
+// interface changes.
+func Selector(s *ifselect.Selector) Opt {
+	return &OptSelector{
+		selector: s,
+	}
+}
+
+func (o *OptSelector) apply(t *Transport) {
+	t.selector = o.selector
+}
@@ -0,0 +1,165 @@
+package udp
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/netwatch"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+)
+
+var (
+	ErrNoInterfaces = errors.New("no interfaces to send on")
+	ErrNotOpen      = errors.New("socket could not be opened")
+)
+
+// Transport sends and receives UDP multicast on a set of interfaces.
+type Transport struct {
+	mutex sync.Mutex
+
+	ifis        []*net.Interface
+	options     multicast.SocketOptions
+	concurrency int
+	logger      *slog.Logger
+	dispatcher  *multicast.Dispatcher
+
+	// Sockets to send on per network, in the order of ifis. The slices are
+	// replaced rather than modified, so that senders can use them unlocked.
+	// Entries are nil for interfaces whose socket could not be opened.
+	pcs map[string][]*multicast.PacketConn
+
+	selector *ifselect.Selector
+	watcher  *netwatch.Watcher
+	onEvent  func(Event)
+	done     chan struct{}
+}
+
+var _ transport.Transport = (*Transport)(nil)
+
+func New(ifis []*net.Interface, opts ...Opt) *Transport {
+	t := &Transport{
+		ifis:   ifis,
+		logger: slog.Default(),
+		pcs:    make(map[string][]*multicast.PacketConn),
+	}
+
+	for _, opt := range opts {
+		opt.apply(t)
+	}
+
+	t.dispatcher = multicast.NewDispatcher(ifis,
+		multicast.Socket(t.options),
+		multicast.Concurrency(t.concurrency),
+		multicast.Logger(t.logger))
+
+	t.watch()
+
+	return t
+}
+
+func (t *Transport) packetConns(network string) ([]*multicast.PacketConn, []*net.Interface, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if pcs, ok := t.pcs[network]; ok {
+		return pcs, t.ifis, nil
+	}
+
+	pcs, err := multicast.OpenPacketConns(network, t.ifis, 0, t.options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.pcs[network] = pcs
+
+	return pcs, t.ifis, nil
+}
+
+// Open opens the sockets to send on for the given networks, so that setup
+// failures surface before the first packet is sent.
+func (t *Transport) Open(networks ...string) error {
+	for _, network := range networks {
+		if _, _, err := t.packetConns(network); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Send sends payload to group on every interface. Failures on individual
+// interfaces do not keep the packet from being sent on the others.
+func (t *Transport) Send(payload []byte, group *net.UDPAddr) error {
+	pcs, ifis, err := t.packetConns(multicast.Network(group.IP))
+	if err != nil {
+		return err
+	}
+
+	if len(pcs) == 0 {
+		return ErrNoInterfaces
+	}
+
+	var errs []error
+
+	for i, pc := range pcs {
+		if pc == nil {
+			errs = append(errs, &transport.InterfaceError{Interface: ifis[i].Name, Err: ErrNotOpen})
+			continue
+		}
+
+		if _, err := pc.WriteTo(payload, group); err != nil {
+			errs = append(errs, &transport.InterfaceError{Interface: ifis[i].Name, Err: err})
+		}
+	}
+
+	if len(errs) > 0 && len(errs) < len(pcs) {
+		return &transport.PartialError{Err: errors.Join(errs...)}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t *Transport) Join(group *net.UDPAddr, h transport.Handler, sources ...net.IP) (transport.Membership, error) {
+	return t.dispatcher.AddConsumer(group, h, sources...)
+}
+
+func (t *Transport) Interfaces() []*net.Interface {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.ifis
+}
+
+func (t *Transport) Close() error {
+	if t.watcher != nil {
+		t.watcher.Close()
+		<-t.done
+	}
+
+	t.dispatcher.Close()
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	var errs []error
+
+	for _, pcs := range t.pcs {
+		for _, pc := range pcs {
+			if pc == nil {
+				continue
+			}
+
+			if err := pc.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	clear(t.pcs)
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,247 @@
+package udp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/netwatch"
+)
+
+// Event reports a change of one of the transport's interfaces and how the
+// transport reacted to it.
+type Event struct {
+	netwatch.Event
+
+	// Interface is the name of the affected interface.
+	Interface string
+
+	// Added and Removed are set if the interface was added to or removed
+	// from the transport because the selection changed.
+	Added   bool
+	Removed bool
+
+	// Renewed is set if the sockets of the interface were reopened and its
+	// groups rejoined. Err is set if that or adding the interface failed.
+	Renewed bool
+	Err     error
+}
+
+// watch starts following interface changes. Without netlink, the transport
+// still works, but does not recover from link flaps.
+func (t *Transport) watch() {
+	w, err := netwatch.New()
+	if err != nil {
+		t.logger.Warn("not watching interfaces", "error", err)
+		return
+	}
+
+	t.watcher = w
+	t.done = make(chan struct{})
+
+	go func() {
+		defer close(t.done)
+
+		for e := range w.Events() {
+			t.handleEvent(e, net.InterfaceByIndex)
+		}
+	}()
+}
+
+// handleEvent reacts to e, looking up the current state of the interface it
+// names through lookup.
+func (t *Transport) handleEvent(e netwatch.Event, lookup func(index int) (*net.Interface, error)) {
+	if t.selector != nil && t.reselect() {
+		// Interfaces that were just added are fresh already.
+		return
+	}
+
+	t.mutex.Lock()
+
+	i := slices.IndexFunc(t.ifis, func(ifi *net.Interface) bool {
+		// A recreated interface has a new index, but keeps its name.
+		return ifi.Index == e.Index || (e.Type == netwatch.LinkUp && ifi.Name == e.Name)
+	})
+
+	var name string
+	if i >= 0 {
+		name = t.ifis[i].Name
+	}
+
+	t.mutex.Unlock()
+
+	if i < 0 {
+		return
+	}
+
+	ev := Event{
+		Event:     e,
+		Interface: name,
+	}
+
+	if e.Type == netwatch.LinkUp || e.Type == netwatch.AddressAdded {
+		ev.Renewed = true
+
+		if ifi, err := lookup(e.Index); err != nil {
+			ev.Err = fmt.Errorf("failed to look up interface %d: %w", e.Index, err)
+		} else {
+			ev.Err = t.renew(i, ifi)
+		}
+
+		if e.Name != "" {
+			ev.Interface = e.Name
+		}
+	}
+
+	t.emit(ev)
+}
+
+func (t *Transport) emit(ev Event) {
+	logger := t.logger.With("interface", ev.Interface, "event", ev.Type.String())
+
+	switch {
+	case ev.Err != nil:
+		logger.Error("failed to update interface", "error", ev.Err)
+	case ev.Added:
+		logger.Info("interface added")
+	case ev.Removed:
+		logger.Info("interface removed")
+	default:
+		logger.Info("interface changed", "renewed", ev.Renewed)
+	}
+
+	if t.onEvent != nil {
+		t.onEvent(ev)
+	}
+}
+
+// reselect evaluates the selector again and updates the set of interfaces
+// accordingly. It returns whether the set has changed.
+func (t *Transport) reselect() bool {
+	ifis, err := t.selector.Select()
+	if err != nil && !errors.Is(err, ifselect.ErrNoInterfaces) {
+		t.logger.Error("failed to select interfaces", "error", err)
+		return false
+	}
+
+	t.mutex.Lock()
+	old := t.ifis
+	t.mutex.Unlock()
+
+	same := func(a, b *net.Interface) bool {
+		return a.Index == b.Index && a.Name == b.Name
+	}
+
+	if slices.EqualFunc(old, ifis, same) {
+		return false
+	}
+
+	err = t.setInterfaces(ifis)
+
+	for _, ifi := range old {
+		if !slices.ContainsFunc(ifis, func(o *net.Interface) bool { return same(o, ifi) }) {
+			t.emit(Event{Event: netwatch.Event{Type: netwatch.LinkRemoved, Index: ifi.Index, Name: ifi.Name}, Interface: ifi.Name, Removed: true})
+		}
+	}
+
+	for _, ifi := range ifis {
+		if !slices.ContainsFunc(old, func(o *net.Interface) bool { return same(o, ifi) }) {
+			t.emit(Event{Event: netwatch.Event{Type: netwatch.LinkUp, Index: ifi.Index, Name: ifi.Name}, Interface: ifi.Name, Added: true, Err: err})
+		}
+	}
+
+	return true
+}
+
+// setInterfaces replaces the set of interfaces, keeping the sockets of the
+// interfaces that remain.
+func (t *Transport) setInterfaces(ifis []*net.Interface) error {
+	var errs []error
+
+	t.mutex.Lock()
+
+	for network, pcs := range t.pcs {
+		newPcs := make([]*multicast.PacketConn, len(ifis))
+		kept := make([]bool, len(pcs))
+
+		for i, ifi := range ifis {
+			j := slices.IndexFunc(t.ifis, func(o *net.Interface) bool {
+				return o.Index == ifi.Index && o.Name == ifi.Name
+			})
+
+			if j >= 0 {
+				newPcs[i] = pcs[j]
+				kept[j] = true
+
+				continue
+			}
+
+			pc, err := multicast.OpenPacketConns(network, []*net.Interface{ifi}, 0, t.options)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			newPcs[i] = pc[0]
+		}
+
+		for j, pc := range pcs {
+			if !kept[j] && pc != nil {
+				pc.Close()
+			}
+		}
+
+		t.pcs[network] = newPcs
+	}
+
+	t.ifis = ifis
+
+	t.mutex.Unlock()
+
+	if err := t.dispatcher.SetInterfaces(ifis); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// renew reopens the sockets to send on and rejoins the groups on the
+// interface at position i, which is now ifi.
+func (t *Transport) renew(i int, ifi *net.Interface) error {
+	var errs []error
+
+	t.mutex.Lock()
+
+	t.ifis = slices.Clone(t.ifis)
+	t.ifis[i] = ifi
+
+	for network, pcs := range t.pcs {
+		pc, err := multicast.OpenPacketConns(network, []*net.Interface{ifi}, 0, t.options)
+		if err != nil {
+			// Keep the old socket, which may still work.
+			errs = append(errs, err)
+			continue
+		}
+
+		pcs = slices.Clone(pcs)
+
+		if pcs[i] != nil {
+			pcs[i].Close()
+		}
+
+		pcs[i] = pc[0]
+
+		t.pcs[network] = pcs
+	}
+
+	t.mutex.Unlock()
+
+	if err := t.dispatcher.Rejoin(ifi); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
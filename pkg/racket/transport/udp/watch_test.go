@@ -0,0 +1,230 @@
+package udp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/holoplot/go-racket/pkg/ifselect"
+	"github.com/holoplot/go-racket/pkg/multicast"
+	"github.com/holoplot/go-racket/pkg/netwatch"
+	"github.com/holoplot/go-racket/pkg/racket/transport"
+)
+
+func loopback(t *testing.T) *net.Interface {
+	t.Helper()
+
+	lo, err := net.InterfaceByName("lo")
+	if err != nil {
+		t.Skipf("no loopback interface: %v", err)
+	}
+
+	return lo
+}
+
+// newTestTransport creates a transport on ifis with its IPv4 sockets open
+// and returns the events it reports.
+func newTestTransport(t *testing.T, ifis []*net.Interface, opts ...Opt) (*Transport, <-chan Event) {
+	t.Helper()
+
+	events := make(chan Event, 16)
+
+	tr := New(ifis, append(opts, OnEvent(func(ev Event) { events <- ev }))...)
+	t.Cleanup(func() { tr.Close() })
+
+	if err := tr.Open(multicast.NetworkIPv4); err != nil {
+		t.Fatalf("failed to open sockets: %v", err)
+	}
+
+	return tr, events
+}
+
+// lookupAs returns an interface lookup that finds ifi under any index.
+func lookupAs(ifi *net.Interface) func(int) (*net.Interface, error) {
+	return func(index int) (*net.Interface, error) {
+		found := *ifi
+		found.Index = index
+
+		return &found, nil
+	}
+}
+
+func (t *Transport) packetConn(network string, i int) *multicast.PacketConn {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	return t.pcs[network][i]
+}
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		return ev
+	default:
+		t.Fatal("no event reported")
+		return Event{}
+	}
+}
+
+func TestTransport_HandleEvent(t *testing.T) {
+	lo := loopback(t)
+
+	tests := []struct {
+		name      string
+		recreated bool
+		event     netwatch.Event
+	}{
+		{
+			name:  "link up",
+			event: netwatch.Event{Type: netwatch.LinkUp, Index: lo.Index, Name: lo.Name},
+		},
+		{
+			name:      "recreated",
+			recreated: true,
+			event:     netwatch.Event{Type: netwatch.LinkUp, Index: lo.Index, Name: lo.Name},
+		},
+		{
+			name:  "address added",
+			event: netwatch.Event{Type: netwatch.AddressAdded, Index: lo.Index},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, events := newTestTransport(t, []*net.Interface{lo})
+			old := tr.packetConn(multicast.NetworkIPv4, 0)
+
+			if tt.recreated {
+				// The interface was deleted and created again, so the
+				// transport still knows it under its old index.
+				stale := *lo
+				stale.Index += 1000
+
+				tr.mutex.Lock()
+				tr.ifis = []*net.Interface{&stale}
+				tr.mutex.Unlock()
+			}
+
+			tr.handleEvent(tt.event, lookupAs(lo))
+
+			ev := nextEvent(t, events)
+			if !ev.Renewed || ev.Err != nil || ev.Interface != lo.Name {
+				t.Errorf("unexpected event %+v", ev)
+			}
+
+			if ifis := tr.Interfaces(); ifis[0].Index != lo.Index {
+				t.Errorf("expected interface index %d, got %d", lo.Index, ifis[0].Index)
+			}
+
+			if tr.packetConn(multicast.NetworkIPv4, 0) == old {
+				t.Error("expected the socket to be reopened")
+			}
+		})
+	}
+}
+
+func TestTransport_HandleEventIgnored(t *testing.T) {
+	lo := loopback(t)
+	tr, events := newTestTransport(t, []*net.Interface{lo})
+	old := tr.packetConn(multicast.NetworkIPv4, 0)
+
+	// Events of other interfaces are ignored.
+	tr.handleEvent(netwatch.Event{Type: netwatch.LinkUp, Index: lo.Index + 1000, Name: "other0"}, lookupAs(lo))
+
+	select {
+	case ev := <-events:
+		t.Errorf("unexpected event %+v", ev)
+	default:
+	}
+
+	// Other changes are reported, but leave the sockets alone.
+	tr.handleEvent(netwatch.Event{Type: netwatch.LinkDown, Index: lo.Index, Name: lo.Name}, lookupAs(lo))
+
+	if ev := nextEvent(t, events); ev.Renewed || ev.Interface != lo.Name {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	// A failed lookup is reported.
+	errLookup := errors.New("lookup failed")
+
+	tr.handleEvent(netwatch.Event{Type: netwatch.AddressAdded, Index: lo.Index}, func(int) (*net.Interface, error) {
+		return nil, errLookup
+	})
+
+	if ev := nextEvent(t, events); !errors.Is(ev.Err, errLookup) {
+		t.Errorf("expected lookup error, got %+v", ev)
+	}
+
+	if tr.packetConn(multicast.NetworkIPv4, 0) != old {
+		t.Error("expected the socket to be kept")
+	}
+}
+
+func TestTransport_SetInterfaces(t *testing.T) {
+	lo := loopback(t)
+	tr, _ := newTestTransport(t, []*net.Interface{lo})
+	old := tr.packetConn(multicast.NetworkIPv4, 0)
+
+	// No socket can be bound to an interface that does not exist.
+	gone := &net.Interface{Index: lo.Index + 1000, Name: "gone0"}
+
+	if err := tr.setInterfaces([]*net.Interface{lo, gone}); err == nil {
+		t.Fatal("expected opening a socket on a missing interface to fail")
+	}
+
+	if tr.packetConn(multicast.NetworkIPv4, 0) != old {
+		t.Error("expected the socket of the remaining interface to be kept")
+	}
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 1, 10), Port: 19127}
+
+	var pe *transport.PartialError
+	if err := tr.Send([]byte("foo"), group); !errors.As(err, &pe) || !errors.Is(err, ErrNotOpen) {
+		t.Errorf("expected partial failure on the missing interface, got %v", err)
+	}
+
+	if err := tr.Close(); err != nil {
+		t.Errorf("failed to close: %v", err)
+	}
+}
+
+func TestTransport_Reselect(t *testing.T) {
+	lo := loopback(t)
+	sel := &ifselect.Selector{Include: []string{"none0"}}
+	tr, events := newTestTransport(t, []*net.Interface{lo}, Selector(sel))
+
+	// The selection no longer matches the interface.
+	tr.handleEvent(netwatch.Event{Type: netwatch.LinkDown, Index: lo.Index, Name: lo.Name}, lookupAs(lo))
+
+	if ev := nextEvent(t, events); !ev.Removed || ev.Interface != lo.Name {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 255, 1, 11), Port: 19128}
+
+	if err := tr.Send([]byte("foo"), group); !errors.Is(err, ErrNoInterfaces) {
+		t.Errorf("expected ErrNoInterfaces, got %v", err)
+	}
+
+	// The interface is selected again.
+	sel.Include = []string{lo.Name}
+
+	tr.handleEvent(netwatch.Event{Type: netwatch.LinkUp, Index: lo.Index, Name: lo.Name}, lookupAs(lo))
+
+	if ev := nextEvent(t, events); !ev.Added || ev.Err != nil || ev.Interface != lo.Name {
+		t.Errorf("unexpected event %+v", ev)
+	}
+
+	if err := tr.Send([]byte("foo"), group); err != nil {
+		t.Errorf("failed to send on the selected interface: %v", err)
+	}
+
+	// Without a change of the selection, the event is handled as usual.
+	tr.handleEvent(netwatch.Event{Type: netwatch.AddressAdded, Index: lo.Index}, lookupAs(lo))
+
+	if ev := nextEvent(t, events); !ev.Renewed || ev.Added {
+		t.Errorf("unexpected event %+v", ev)
+	}
+}